@@ -1,60 +1,255 @@
 package main
 
 import (
+	"context"
 	"crud-go/internal/config"
+	"crud-go/internal/entity"
+	"crud-go/internal/repository/cache"
 	"crud-go/internal/repository/psql"
 	"crud-go/internal/service"
 	"crud-go/internal/transport/rest"
+	"crud-go/migrations"
 	"crud-go/pkg/database"
 	"crud-go/pkg/hash"
+	"crud-go/pkg/health"
+	"crud-go/pkg/logging"
+	"crud-go/pkg/migrate"
+	"crud-go/pkg/telemetry"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/sirupsen/logrus"
 )
 
-func checkCurRelations(db *sql.DB) {
-	// Query to retrieve all tables in the current database
-	rows, err := db.Query("SELECT table_name FROM information_schema.tables WHERE table_schema = 'public' AND table_type = 'BASE TABLE'")
-	if err != nil {
-		logrus.Fatal(err)
+// checkHealth runs every health check once at startup and refuses to start
+// while one of them fails.
+func checkHealth(registry *health.Registry) {
+	report := registry.Check(context.Background())
+	for _, c := range report.Checks {
+		entry := logrus.WithFields(logrus.Fields{
+			"check":   c.Name,
+			"status":  c.Status,
+			"latency": c.Latency,
+		})
+		if c.Status != health.StatusUp {
+			entry.Error(c.Error)
+		} else {
+			entry.Info("Health check passed")
+		}
+	}
+
+	if report.Status != health.StatusUp {
+		logrus.Fatal("health checks failed")
 	}
-	defer rows.Close()
+}
 
-	var tables []string
+func migrateSchema(migrator *migrate.Migrator, auto bool) {
+	ctx := context.Background()
 
-	for rows.Next() {
-		var table string
-		err := rows.Scan(&table)
+	if auto {
+		applied, err := migrator.Up(ctx)
 		if err != nil {
 			logrus.Fatal(err)
 		}
-		tables = append(tables, table)
+
+		for _, m := range applied {
+			logrus.WithFields(logrus.Fields{
+				"version": m.Version,
+				"name":    m.Name,
+			}).Info("Migration applied")
+		}
+	}
+
+	if err := migrator.Verify(ctx); err != nil {
+		logrus.Fatal(err)
 	}
 
 	logrus.WithFields(logrus.Fields{
-		"tables": tables,
-	}).Info("Tables in the current database")
+		"version": migrator.Latest(),
+	}).Info("Schema is up to date")
+}
 
-	if err = rows.Err(); err != nil {
-		logrus.Fatal(err)
+// runMigrateCommand handles `migrate up`, `migrate down [steps]` and
+// `migrate version`.
+func runMigrateCommand(migrator *migrate.Migrator, args []string) error {
+	ctx := context.Background()
+
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down [steps]|version")
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "version":
+		version, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("current %d, latest %d\n", version, migrator.Latest())
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
 	}
 }
 
-func checkCurDB(db *sql.DB) {
-	// Query to retrieve the name of the current database
-	var dbName string
-	err := db.QueryRow("SELECT current_database()").Scan(&dbName)
+// runImportCommand upserts the phones of a CSV or NDJSON file, "-" for the
+// standard input, and prints the report.
+func runImportCommand(phonesService *service.Phones, args []string, format string, dryRun bool) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: import [--dry-run] [--format csv|ndjson] FILE")
+	}
+	path := args[0]
+
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			format = "csv"
+		case ".ndjson", ".jsonl":
+			format = "ndjson"
+		default:
+			return fmt.Errorf("can't tell the format of %q, use --format", path)
+		}
+	}
+	importFormat, err := entity.ParseImportFormat(format)
 	if err != nil {
-		logrus.Fatal(err)
+		return err
 	}
 
-	// Print the name of the current database
-	logrus.WithFields(logrus.Fields{
-		"tables": dbName,
-	}).Info("Current database")
+	in := os.Stdin
+	if path != "-" {
+		if in, err = os.Open(path); err != nil {
+			return err
+		}
+		defer in.Close()
+	}
+
+	rows, err := entity.NewPhoneRowReader(in, importFormat)
+	if err != nil {
+		return err
+	}
+
+	// The command line acts as nobody in particular, so the phones get no
+	// creator.
+	report, err := phonesService.ImportPhones(context.Background(), entity.Actor{Role: entity.RoleAdmin}, rows, dryRun)
+	if err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+
+	if report.Failed > 0 {
+		return fmt.Errorf("%d of %d rows failed", report.Failed, report.Rows)
+	}
+
+	return nil
+}
+
+func newPasswordHasher(cfg config.Password) (*hash.PasswordHasher, error) {
+	argon2id := hash.NewArgon2idHasher(hash.Argon2idParams{
+		Memory:  cfg.Argon2Memory,
+		Time:    cfg.Argon2Time,
+		Threads: cfg.Argon2Threads,
+		SaltLen: hash.DefaultArgon2idParams.SaltLen,
+		KeyLen:  hash.DefaultArgon2idParams.KeyLen,
+	})
+	bcrypt := hash.NewBcryptHasher(cfg.BcryptCost)
+	legacy := hash.NewSHA1Hasher(cfg.LegacySalt)
+
+	switch cfg.Algorithm {
+	case "argon2id":
+		return hash.NewPasswordHasher(argon2id, bcrypt, legacy), nil
+	case "bcrypt":
+		return hash.NewPasswordHasher(bcrypt, argon2id, legacy), nil
+	default:
+		return nil, fmt.Errorf("unknown password algorithm %q", cfg.Algorithm)
+	}
+}
+
+func purgeRevocations(ctx context.Context, usersService *service.User, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		purged, err := usersService.PurgeExpiredRevocations(ctx)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"job":     "purgeRevocations",
+				"problem": "service error",
+			}).Error(err)
+			continue
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"purged": purged,
+		}).Debug("Expired revocations purged")
+	}
+}
+
+func purgeDeletedPhones(ctx context.Context, phonesService *service.Phones, cfg config.Trash) {
+	ticker := time.NewTicker(cfg.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		purged, err := phonesService.PurgeDeletedPhones(ctx, cfg.Retention)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"job":     "purgeDeletedPhones",
+				"problem": "service error",
+			}).Error(err)
+			continue
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"purged": purged,
+		}).Debug("Deleted phones purged")
+	}
 }
 
 // @title Phone API
@@ -62,53 +257,197 @@ func checkCurDB(db *sql.DB) {
 // @version 1.0
 // @host localhost:8080
 // @BasePath /api/phones
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
 
 func init() {
 	logrus.SetFormatter(&logrus.JSONFormatter{})
 	logrus.SetOutput(os.Stdout)
 	logrus.SetLevel(logrus.InfoLevel)
+	logrus.AddHook(logging.RedactHook{})
+}
+
+func setupLogging(cfg config.Logging) {
+	if level, err := logrus.ParseLevel(cfg.Level); err == nil {
+		logrus.SetLevel(level)
+	}
+	if cfg.Format == "text" {
+		logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	}
 }
 
 func main() {
+	loader := config.NewLoader(os.Args[0])
+	redacted := loader.Flags().Bool("redacted", false, "mask secrets in `config print`")
+	importFormat := loader.Flags().String("format", "", "format of the `import` file: csv or ndjson (default from the extension)")
+	importDryRun := loader.Flags().Bool("dry-run", false, "only report what `import` would do")
 
-	dbConfig, err := config.New()
+	cfg, err := loader.Load(os.Args[1:])
 	if err != nil {
 		logrus.Fatal(err)
 	}
+	args := loader.Flags().Args()
+
+	if len(args) > 0 && args[0] == "config" {
+		if len(args) < 2 || args[1] != "print" {
+			logrus.Fatal("usage: config print [--redacted]")
+		}
+		if err := cfg.Print(os.Stdout, *redacted); err != nil {
+			logrus.Fatal(err)
+		}
+		return
+	}
+
+	setupLogging(cfg.Logging)
+	if file := loader.File(); file != "" {
+		logrus.WithFields(logrus.Fields{
+			"file": file,
+		}).Info("Configuration file loaded")
+	}
 
 	db, err := database.NewPostgresConnection(database.ConnectionInfo{
-		Host:     dbConfig.DB.Host,
-		Port:     dbConfig.DB.Port,
-		Username: dbConfig.DB.Username,
-		DBName:   dbConfig.DB.Name,
-		SSLMode:  dbConfig.DB.SSLMode,
-		Password: dbConfig.DB.Password,
+		Host:     cfg.DB.Host,
+		Port:     cfg.DB.Port,
+		Username: cfg.DB.Username,
+		DBName:   cfg.DB.Name,
+		SSLMode:  cfg.DB.SSLMode,
+		Password: cfg.DB.Password,
 	})
 
 	if err != nil {
 		logrus.Fatal(err)
 	}
-	defer db.Close()
 
-	checkCurRelations(db)
-	checkCurDB(db)
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, cfg.DB.Name))
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrateCommand(migrator, args[1:]); err != nil {
+			logrus.Fatal(err)
+		}
+		return
+	}
 
-	var b []byte
+	if err := cfg.Validate(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"problem": "invalid configuration",
+		}).Fatal(err)
+	}
+
+	migrateSchema(migrator, cfg.DB.Migrations.Auto)
+
+	healthRegistry := health.NewRegistry(cfg.Health.Timeout)
+	healthRegistry.Register(psql.NewHealth(db), migrator)
+	checkHealth(healthRegistry)
 
 	phonesRepository := psql.NewPhone(db)
 	usersRepository := psql.NewUser(db)
-	phonesService := service.NewPhones(phonesRepository)
-	usersService := service.NewUser(usersRepository, hash.NewSHA1Hasher("salt"), b, 2*time.Minute)
-	controller := rest.NewController(phonesService, usersService)
+	refreshRepository := psql.NewRefreshToken(db)
+	revocations := cache.NewRevocation(psql.NewRevocation(db), cfg.Auth.RevocationCacheTTL)
+	phonesService := service.NewPhones(phonesRepository, cfg.Features.EnforceOwnership, cfg.Import.NaturalKey, cfg.Import.BatchSize)
+
+	if len(args) > 0 && args[0] == "import" {
+		if err := runImportCommand(phonesService, args[1:], *importFormat, *importDryRun); err != nil {
+			logrus.Fatal(err)
+		}
+		return
+	}
+
+	hasher, err := newPasswordHasher(cfg.Auth.Password)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := telemetry.SetupTracing(ctx, telemetry.TracingOptions{
+		ServiceName: cfg.Tracing.ServiceName,
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	usersService := service.NewUser(usersRepository, refreshRepository, revocations, hasher,
+		[]byte(cfg.Auth.HMACSecret), cfg.Auth.AccessTokenTTL, cfg.Auth.RefreshTokenTTL)
+	go purgeRevocations(ctx, usersService, cfg.Auth.RevocationPurgeInterval)
+	go purgeDeletedPhones(ctx, phonesService, cfg.Trash)
+
+	if err := phonesService.RebuildSuggestIndex(ctx); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"problem": "building the suggestion index",
+		}).Fatal(err)
+	}
+	controller := rest.NewController(phonesService, usersService, healthRegistry, cfg.Features.RequireIfMatch, cfg.Import.Timeout)
 
 	srv := &http.Server{
-		Addr:    ":8080",
-		Handler: controller.InitRouter(),
+		Addr:              cfg.Server.Addr,
+		Handler:           controller.InitRouter(),
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
 	}
 
-	logrus.Info("SERVER STARTED")
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	controller.SetReady(true)
+	logrus.WithFields(logrus.Fields{
+		"addr": srv.Addr,
+	}).Info("SERVER STARTED")
 
-	if err := srv.ListenAndServe(); err != nil {
+	select {
+	case err := <-serverErr:
 		logrus.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	shutdown(srv, db, controller, cfg.Server)
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"problem": "flushing spans",
+		}).Error(err)
+	}
+}
+
+// shutdown first reports the instance as not ready and gives load balancers
+// DrainDelay to notice, then stops accepting connections, waits for the
+// requests in flight and finally closes the database pool.
+func shutdown(srv *http.Server, db *sql.DB, controller *rest.Controller, cfg config.Server) {
+	logrus.Info("SHUTTING DOWN")
+	controller.SetReady(false)
+	time.Sleep(cfg.DrainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"problem": "requests still in flight after the grace period",
+		}).Error(err)
 	}
+
+	if err := db.Close(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"problem": "closing database",
+		}).Error(err)
+	}
+
+	logrus.Info("SERVER STOPPED")
 }
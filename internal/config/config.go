@@ -1,28 +1,343 @@
 package config
 
 import (
-	"github.com/kelseyhightower/envconfig"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	DB PostgresConnection
+	Server   Server             `mapstructure:"server" yaml:"server"`
+	Auth     Auth               `mapstructure:"auth" yaml:"auth"`
+	Logging  Logging            `mapstructure:"logging" yaml:"logging"`
+	DB       PostgresConnection `mapstructure:"database" yaml:"database"`
+	Features Features           `mapstructure:"features" yaml:"features"`
+	Health   Health             `mapstructure:"health" yaml:"health"`
+	Tracing  Tracing            `mapstructure:"tracing" yaml:"tracing"`
+	Trash    Trash              `mapstructure:"trash" yaml:"trash"`
+	Import   Import             `mapstructure:"import" yaml:"import"`
+}
+
+type Server struct {
+	Addr              string        `mapstructure:"addr" yaml:"addr"`
+	ReadTimeout       time.Duration `mapstructure:"read_timeout" yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout" yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `mapstructure:"write_timeout" yaml:"write_timeout"`
+	IdleTimeout       time.Duration `mapstructure:"idle_timeout" yaml:"idle_timeout"`
+	MaxHeaderBytes    int           `mapstructure:"max_header_bytes" yaml:"max_header_bytes"`
+
+	// DrainDelay is how long the server keeps serving after it has
+	// started failing readiness checks, so that load balancers stop
+	// sending new requests before the listener closes.
+	DrainDelay time.Duration `mapstructure:"drain_delay" yaml:"drain_delay"`
+	// ShutdownTimeout bounds the wait for requests in flight.
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout" yaml:"shutdown_timeout"`
+}
+
+type Auth struct {
+	HMACSecret      string        `mapstructure:"hmac_secret" yaml:"hmac_secret"`
+	AccessTokenTTL  time.Duration `mapstructure:"access_token_ttl" yaml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `mapstructure:"refresh_token_ttl" yaml:"refresh_token_ttl"`
+
+	// RevocationCacheTTL is how long a "not revoked" answer is trusted
+	// without asking the database, i.e. how late a logout made on another
+	// instance may be noticed.
+	RevocationCacheTTL      time.Duration `mapstructure:"revocation_cache_ttl" yaml:"revocation_cache_ttl"`
+	RevocationPurgeInterval time.Duration `mapstructure:"revocation_purge_interval" yaml:"revocation_purge_interval"`
+
+	Password Password `mapstructure:"password" yaml:"password"`
+}
+
+// Password selects the algorithm new password hashes are made with. Hashes
+// made by the other algorithms are still accepted and upgraded on sign in.
+type Password struct {
+	Algorithm     string `mapstructure:"algorithm" yaml:"algorithm"`
+	BcryptCost    int    `mapstructure:"bcrypt_cost" yaml:"bcrypt_cost"`
+	Argon2Memory  uint32 `mapstructure:"argon2_memory" yaml:"argon2_memory"`
+	Argon2Time    uint32 `mapstructure:"argon2_time" yaml:"argon2_time"`
+	Argon2Threads uint8  `mapstructure:"argon2_threads" yaml:"argon2_threads"`
+	// LegacySalt is the salt of the SHA-1 hashes made before Argon2id.
+	LegacySalt string `mapstructure:"legacy_salt" yaml:"legacy_salt"`
+}
+
+type Logging struct {
+	Level  string `mapstructure:"level" yaml:"level"`
+	Format string `mapstructure:"format" yaml:"format"`
 }
 
 type PostgresConnection struct {
-	Host     string
-	Port     int
-	Username string
-	Name     string
-	SSLMode  string
-	Password string
+	Host       string     `mapstructure:"host" yaml:"host"`
+	Port       int        `mapstructure:"port" yaml:"port"`
+	Username   string     `mapstructure:"username" yaml:"username"`
+	Name       string     `mapstructure:"name" yaml:"name"`
+	SSLMode    string     `mapstructure:"sslmode" yaml:"sslmode"`
+	Password   string     `mapstructure:"password" yaml:"password"`
+	Migrations Migrations `mapstructure:"migrations" yaml:"migrations"`
 }
 
-func New() (*Config, error) {
-	cfg := new(Config)
+// Migrations controls what happens to the schema at startup: with Auto the
+// pending migrations are applied, otherwise the schema is only verified.
+type Migrations struct {
+	Auto bool `mapstructure:"auto" yaml:"auto"`
+}
+
+type Features struct {
+	// EnforceOwnership lets only the creator of a phone and administrators
+	// change or delete it.
+	EnforceOwnership bool `mapstructure:"enforce_ownership" yaml:"enforce_ownership"`
+	// RequireIfMatch rejects changes of a phone that don't name the version
+	// they are based on.
+	RequireIfMatch bool `mapstructure:"require_if_match" yaml:"require_if_match"`
+}
+
+type Health struct {
+	// Timeout bounds each dependency check of /readyz and /healthz/details.
+	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout"`
+}
+
+type Tracing struct {
+	ServiceName string `mapstructure:"service_name" yaml:"service_name"`
+	// Exporter is none, otlp (to a collector at Endpoint) or stdout.
+	Exporter    string  `mapstructure:"exporter" yaml:"exporter"`
+	Endpoint    string  `mapstructure:"endpoint" yaml:"endpoint"`
+	Insecure    bool    `mapstructure:"insecure" yaml:"insecure"`
+	SampleRatio float64 `mapstructure:"sample_ratio" yaml:"sample_ratio"`
+}
+
+// Trash controls how long deleted phones can be restored.
+type Trash struct {
+	Retention     time.Duration `mapstructure:"retention" yaml:"retention"`
+	PurgeInterval time.Duration `mapstructure:"purge_interval" yaml:"purge_interval"`
+}
+
+// Import controls the CSV and NDJSON imports of phones.
+type Import struct {
+	// NaturalKey are the fields by which an imported row finds the phone
+	// it updates.
+	NaturalKey []string `mapstructure:"natural_key" yaml:"natural_key"`
+	// BatchSize is the number of rows written per transaction.
+	BatchSize int `mapstructure:"batch_size" yaml:"batch_size"`
+	// Timeout replaces the server read and write timeouts for an import
+	// over HTTP, which streams a body that can take long to upload.
+	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout"`
+}
+
+var defaults = map[string]any{
+	"server.addr":                ":8080",
+	"server.read_timeout":        "15s",
+	"server.read_header_timeout": "5s",
+	"server.write_timeout":       "30s",
+	"server.idle_timeout":        "2m",
+	"server.max_header_bytes":    1 << 20,
+	"server.drain_delay":         "5s",
+	"server.shutdown_timeout":    "30s",
+
+	"auth.hmac_secret":               "",
+	"auth.access_token_ttl":          "15m",
+	"auth.refresh_token_ttl":         "720h",
+	"auth.revocation_cache_ttl":      "5s",
+	"auth.revocation_purge_interval": "10m",
+	"auth.password.algorithm":        "argon2id",
+	"auth.password.bcrypt_cost":      12,
+	"auth.password.argon2_memory":    64 * 1024,
+	"auth.password.argon2_time":      3,
+	"auth.password.argon2_threads":   4,
+	"auth.password.legacy_salt":      "salt",
+
+	"logging.level":  "info",
+	"logging.format": "json",
+
+	"database.host":            "localhost",
+	"database.port":            5432,
+	"database.username":        "postgres",
+	"database.name":            "crud-go",
+	"database.sslmode":         "disable",
+	"database.password":        "",
+	"database.migrations.auto": true,
+
+	"features.enforce_ownership": true,
+	"features.require_if_match":  false,
+
+	"health.timeout": "2s",
+
+	"tracing.service_name": "crud-go",
+	"tracing.exporter":     "none",
+	"tracing.endpoint":     "localhost:4318",
+	"tracing.insecure":     true,
+	"tracing.sample_ratio": 1.0,
+
+	"trash.retention":      "720h",
+	"trash.purge_interval": "1h",
+
+	"import.natural_key": []string{"brand", "model"},
+	"import.batch_size":  500,
+	"import.timeout":     "30m",
+}
+
+// legacyEnv are the environment variables used before the configuration
+// had sections. They are still honoured.
+var legacyEnv = map[string]string{
+	"database.host":     "DB_HOST",
+	"database.port":     "DB_PORT",
+	"database.username": "DB_USERNAME",
+	"database.name":     "DB_NAME",
+	"database.sslmode":  "DB_SSLMODE",
+	"database.password": "DB_PASSWORD",
+}
+
+// Loader layers the configuration, from the lowest priority: defaults, a
+// YAML or TOML file, environment variables, command line flags. Every key
+// has a flag named after it, e.g. --server.addr, and an environment
+// variable, e.g. SERVER_ADDR.
+type Loader struct {
+	v     *viper.Viper
+	flags *pflag.FlagSet
+	file  *string
+}
+
+func NewLoader(name string) *Loader {
+	v := viper.New()
+	flags := pflag.NewFlagSet(name, pflag.ContinueOnError)
 
-	if err := envconfig.Process("db", &cfg.DB); err != nil {
+	l := &Loader{
+		v:     v,
+		flags: flags,
+		file:  flags.StringP("config", "c", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML configuration file"),
+	}
+
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+		flags.String(key, "", fmt.Sprintf("overrides %s (default %v)", key, value))
+		v.BindPFlag(key, flags.Lookup(key))
+	}
+
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	for key, env := range legacyEnv {
+		v.BindEnv(key, strings.ToUpper(strings.ReplaceAll(key, ".", "_")), env)
+	}
+
+	return l
+}
+
+// Flags lets callers add their own flags before Load parses the arguments.
+func (l *Loader) Flags() *pflag.FlagSet {
+	return l.flags
+}
+
+func (l *Loader) Load(args []string) (*Config, error) {
+	if err := l.flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *l.file != "" {
+		l.v.SetConfigFile(*l.file)
+	} else {
+		l.v.SetConfigName("config")
+		l.v.AddConfigPath(".")
+		l.v.AddConfigPath("./configs")
+	}
+
+	if err := l.v.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) {
+			return nil, fmt.Errorf("reading config file: %w", err)
+		}
+	}
+
+	cfg := new(Config)
+	if err := l.v.Unmarshal(cfg); err != nil {
 		return nil, err
 	}
 
 	return cfg, nil
 }
+
+// File is the configuration file that was read, "" when there was none.
+func (l *Loader) File() string {
+	return l.v.ConfigFileUsed()
+}
+
+var importKeyFields = []string{"brand", "model", "year", "os", "processor"}
+
+// Validate reports every setting the server can't start with.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr is empty")
+	check(c.Server.ReadTimeout > 0, "server.read_timeout must be positive")
+	check(c.Server.ReadHeaderTimeout > 0, "server.read_header_timeout must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout must be positive")
+	check(c.Server.MaxHeaderBytes > 0, "server.max_header_bytes must be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+
+	check(c.Auth.HMACSecret != "", "auth.hmac_secret is empty")
+	check(c.Auth.HMACSecret == "" || len(c.Auth.HMACSecret) >= 32, "auth.hmac_secret must be at least 32 bytes long")
+	check(c.Auth.AccessTokenTTL > 0, "auth.access_token_ttl must be positive")
+	check(c.Auth.RefreshTokenTTL > c.Auth.AccessTokenTTL, "auth.refresh_token_ttl must be longer than auth.access_token_ttl")
+	check(c.Auth.RevocationPurgeInterval > 0, "auth.revocation_purge_interval must be positive")
+	check(c.Auth.Password.Algorithm == "argon2id" || c.Auth.Password.Algorithm == "bcrypt",
+		"auth.password.algorithm must be argon2id or bcrypt, got %q", c.Auth.Password.Algorithm)
+
+	_, err := logrus.ParseLevel(c.Logging.Level)
+	check(err == nil, "logging.level: %v", err)
+	check(c.Logging.Format == "json" || c.Logging.Format == "text",
+		"logging.format must be json or text, got %q", c.Logging.Format)
+
+	check(c.DB.Host != "", "database.host is empty")
+	check(c.DB.Port > 0 && c.DB.Port < 1<<16, "database.port %d is out of range", c.DB.Port)
+	check(c.DB.Name != "", "database.name is empty")
+
+	check(c.Health.Timeout > 0, "health.timeout must be positive")
+
+	check(c.Tracing.Exporter == "none" || c.Tracing.Exporter == "otlp" || c.Tracing.Exporter == "stdout",
+		"tracing.exporter must be none, otlp or stdout, got %q", c.Tracing.Exporter)
+	check(c.Tracing.Exporter != "otlp" || c.Tracing.Endpoint != "", "tracing.endpoint is empty")
+	check(c.Trash.Retention > 0, "trash.retention must be positive")
+	check(c.Trash.PurgeInterval > 0, "trash.purge_interval must be positive")
+
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+
+	check(len(c.Import.NaturalKey) > 0, "import.natural_key is empty")
+	for _, field := range c.Import.NaturalKey {
+		check(slices.Contains(importKeyFields, field),
+			"import.natural_key: unknown field %q, use %s", field, strings.Join(importKeyFields, ", "))
+	}
+	check(c.Import.BatchSize > 0 && c.Import.BatchSize <= 5000, "import.batch_size must be between 1 and 5000")
+	check(c.Import.Timeout > 0, "import.timeout must be positive")
+
+	return errors.Join(errs...)
+}
+
+// Print writes the effective configuration as YAML. With redacted, secrets
+// are masked.
+func (c *Config) Print(w io.Writer, redacted bool) error {
+	out := *c
+	if redacted {
+		for _, secret := range []*string{&out.Auth.HMACSecret, &out.Auth.Password.LegacySalt, &out.DB.Password} {
+			if *secret != "" {
+				*secret = "REDACTED"
+			}
+		}
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	defer enc.Close()
+
+	return enc.Encode(out)
+}
@@ -0,0 +1,11 @@
+package entity
+
+// Actor is the authenticated user on whose behalf a change is made.
+type Actor struct {
+	UserID int64
+	Role   Role
+}
+
+func (a Actor) IsAdmin() bool {
+	return a.Role == RoleAdmin
+}
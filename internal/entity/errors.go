@@ -0,0 +1,11 @@
+package entity
+
+import "errors"
+
+// ErrDuplicate is returned by repositories when a write breaks a uniqueness
+// constraint.
+var ErrDuplicate = errors.New("duplicate")
+
+// ErrVersionMismatch is returned by repositories when a conditional write
+// finds the record at another version than the caller expected.
+var ErrVersionMismatch = errors.New("version mismatch")
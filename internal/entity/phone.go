@@ -1,5 +1,7 @@
 package entity
 
+import "time"
+
 type Phone struct {
 	Id        int
 	Brand     string
@@ -7,12 +9,25 @@ type Phone struct {
 	Year      int
 	OS        string
 	Processor string
+	CreatedBy *int64
+	UpdatedBy *int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Version grows with every change and is the phone's ETag.
+	Version int64
+	// DeletedAt is set while the phone is in the trash.
+	DeletedAt *time.Time
+	DeletedBy *int64
 }
 
 type PhoneInputDto struct {
-	Brand     string
-	Model     string
-	Year      int
-	OS        string
-	Processor string
+	Brand     string `json:"brand" validate:"required,max=64"`
+	Model     string `json:"model" validate:"required,max=128"`
+	Year      int    `json:"year" validate:"required,phoneyear"`
+	OS        string `json:"os" validate:"required,max=64,phoneos"`
+	Processor string `json:"processor" validate:"required,max=128"`
+}
+
+func (i PhoneInputDto) Validate() error {
+	return validate.Struct(i)
 }
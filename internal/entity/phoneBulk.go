@@ -0,0 +1,54 @@
+package entity
+
+import "fmt"
+
+type BulkAction string
+
+const (
+	BulkCreate BulkAction = "create"
+	BulkUpdate BulkAction = "update"
+	BulkDelete BulkAction = "delete"
+)
+
+// PhoneBulkOp is one operation of a bulk write. Update and delete need the
+// ID; Version, when set, must be the phone's current one, like If-Match.
+type PhoneBulkOp struct {
+	Action  BulkAction     `json:"action"`
+	ID      int64          `json:"id,omitempty"`
+	Version int64          `json:"version,omitempty"`
+	Phone   *PhoneInputDto `json:"phone,omitempty"`
+}
+
+// IfMatch returns the versions the phone may be at, nil for any.
+func (op PhoneBulkOp) IfMatch() []int64 {
+	if op.Version == 0 {
+		return nil
+	}
+
+	return []int64{op.Version}
+}
+
+// PhoneBulkResult is the outcome of the operation at Index: the phone it
+// created, updated or moved to the trash, or Err.
+type PhoneBulkResult struct {
+	Index  int
+	Action BulkAction
+	ID     int64
+	Phone  *Phone
+	Err    error
+}
+
+// BulkOpError is the failure of one operation of an atomic bulk write,
+// which rolled back all of them.
+type BulkOpError struct {
+	Index int
+	Err   error
+}
+
+func (e *BulkOpError) Error() string {
+	return fmt.Sprintf("operation %d: %v", e.Index, e.Err)
+}
+
+func (e *BulkOpError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,55 @@
+package entity
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// PhoneFacetFields are the fields the phones can be counted by.
+var PhoneFacetFields = []string{"brand", "os", "processor", "year"}
+
+// ParsePhoneFacetFields parses a comma separated list of facet fields. An
+// empty list means all of them.
+func ParsePhoneFacetFields(s string) ([]string, error) {
+	if s == "" {
+		return slices.Clone(PhoneFacetFields), nil
+	}
+
+	var fields []string
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if !slices.Contains(PhoneFacetFields, field) {
+			return nil, fmt.Errorf("unknown facet field %q", field)
+		}
+		if !slices.Contains(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields, nil
+}
+
+type PhoneFacetQuery struct {
+	PhoneFilter
+	Fields []string
+	// YearInterval is the width of the year buckets in years.
+	YearInterval int
+}
+
+// FacetBucket counts the phones with one value of a field, or for the
+// year, with a release year from From to To inclusive.
+type FacetBucket struct {
+	Value string `json:"value,omitempty"`
+	From  int    `json:"from,omitempty"`
+	To    int    `json:"to,omitempty"`
+	Count int64  `json:"count"`
+}
+
+type PhoneFacets struct {
+	// Total is the number of phones matching the filter.
+	Total int64 `json:"total"`
+	// Facets holds the buckets by field: values by count, most common first,
+	// years in ascending order.
+	Facets map[string][]FacetBucket `json:"facets"`
+}
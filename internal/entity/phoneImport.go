@@ -0,0 +1,290 @@
+package entity
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type ImportFormat string
+
+const (
+	ImportCSV    ImportFormat = "csv"
+	ImportNDJSON ImportFormat = "ndjson"
+)
+
+func ParseImportFormat(s string) (ImportFormat, error) {
+	switch f := ImportFormat(strings.ToLower(s)); f {
+	case ImportCSV, ImportNDJSON:
+		return f, nil
+	}
+
+	return "", fmt.Errorf("unknown import format %q, use csv or ndjson", s)
+}
+
+// PhoneKeyFields are the fields a natural key of the phones can be made of.
+var PhoneKeyFields = []string{"brand", "model", "year", "os", "processor"}
+
+// PhoneNaturalKey identifies the phone by the fields, ignoring the case of
+// the text ones, like the filters of the listing do.
+func PhoneNaturalKey(fields []string, ph PhoneInputDto) string {
+	values := make([]string, len(fields))
+	for i, field := range fields {
+		switch field {
+		case "brand":
+			values[i] = strings.ToLower(ph.Brand)
+		case "model":
+			values[i] = strings.ToLower(ph.Model)
+		case "year":
+			values[i] = strconv.Itoa(ph.Year)
+		case "os":
+			values[i] = strings.ToLower(ph.OS)
+		case "processor":
+			values[i] = strings.ToLower(ph.Processor)
+		}
+	}
+
+	return strings.Join(values, "\x00")
+}
+
+// PhoneImportRow is a row of an import file: the phone, or Err when the
+// row can't be read as one. Line is the line the row starts on.
+type PhoneImportRow struct {
+	Line  int
+	Phone PhoneInputDto
+	Err   error
+}
+
+// PhoneRowReader reads an import file one row at a time. Next returns
+// io.EOF after the last row; other errors mean the file can't be read any
+// further.
+type PhoneRowReader interface {
+	Next() (PhoneImportRow, error)
+}
+
+// NewPhoneRowReader reads a CSV file, whose header names the PhoneInputDto
+// field of every column, or a file with a JSON PhoneInputDto per line.
+func NewPhoneRowReader(r io.Reader, format ImportFormat) (PhoneRowReader, error) {
+	switch format {
+	case ImportCSV:
+		return newCSVPhoneReader(r)
+	case ImportNDJSON:
+		return newNDJSONPhoneReader(r), nil
+	}
+
+	return nil, fmt.Errorf("unknown import format %q", format)
+}
+
+type csvPhoneReader struct {
+	r       *csv.Reader
+	columns []string
+}
+
+func newCSVPhoneReader(r io.Reader) (*csvPhoneReader, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("the CSV file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading the CSV header: %w", err)
+	}
+
+	columns := make([]string, len(header))
+	for i, name := range header {
+		// Spreadsheets like to start the file with a byte order mark.
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if !slices.Contains(PhoneKeyFields, name) {
+			return nil, fmt.Errorf("unknown CSV column %q, use %s", name, strings.Join(PhoneKeyFields, ", "))
+		}
+		if slices.Contains(columns, name) {
+			return nil, fmt.Errorf("CSV column %q appears twice", name)
+		}
+		columns[i] = name
+	}
+
+	for _, field := range PhoneKeyFields {
+		if !slices.Contains(columns, field) {
+			return nil, fmt.Errorf("CSV column %q is missing", field)
+		}
+	}
+
+	return &csvPhoneReader{r: cr, columns: columns}, nil
+}
+
+func (c *csvPhoneReader) Next() (PhoneImportRow, error) {
+	record, err := c.r.Read()
+	if errors.Is(err, io.EOF) {
+		return PhoneImportRow{}, io.EOF
+	}
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return PhoneImportRow{Line: parseErr.StartLine, Err: parseErr.Err}, nil
+	}
+	if err != nil {
+		return PhoneImportRow{}, err
+	}
+
+	line, _ := c.r.FieldPos(0)
+	row := PhoneImportRow{Line: line}
+	for i, value := range record {
+		value = strings.TrimSpace(value)
+		switch c.columns[i] {
+		case "brand":
+			row.Phone.Brand = value
+		case "model":
+			row.Phone.Model = value
+		case "year":
+			if row.Phone.Year, err = strconv.Atoi(value); err != nil && value != "" {
+				row.Err = fmt.Errorf("year %q is not a number", value)
+			}
+		case "os":
+			row.Phone.OS = value
+		case "processor":
+			row.Phone.Processor = value
+		}
+	}
+
+	return row, nil
+}
+
+// maxNDJSONLine bounds the memory a single line can take. Longer lines are
+// skipped and reported as failed rows.
+const maxNDJSONLine = 1 << 20
+
+var errLineTooLong = fmt.Errorf("the line is longer than %d bytes", maxNDJSONLine)
+
+type ndjsonPhoneReader struct {
+	r    *bufio.Reader
+	buf  []byte
+	line int
+}
+
+func newNDJSONPhoneReader(r io.Reader) *ndjsonPhoneReader {
+	return &ndjsonPhoneReader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+func (n *ndjsonPhoneReader) Next() (PhoneImportRow, error) {
+	for {
+		line, err := n.readLine()
+		if errors.Is(err, io.EOF) {
+			return PhoneImportRow{}, io.EOF
+		}
+		if err != nil && !errors.Is(err, errLineTooLong) {
+			return PhoneImportRow{}, fmt.Errorf("line %d: %w", n.line+1, err)
+		}
+
+		n.line++
+		if err != nil {
+			return PhoneImportRow{Line: n.line, Err: err}, nil
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		row := PhoneImportRow{Line: n.line}
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+		row.Err = dec.Decode(&row.Phone)
+
+		return row, nil
+	}
+}
+
+// readLine returns the next line, or errLineTooLong after skipping a line
+// longer than maxNDJSONLine. It returns io.EOF only when nothing is left.
+func (n *ndjsonPhoneReader) readLine() ([]byte, error) {
+	n.buf = n.buf[:0]
+	tooLong, read := false, false
+	for {
+		chunk, err := n.r.ReadSlice('\n')
+		read = read || len(chunk) > 0
+		if !tooLong && len(n.buf)+len(bytes.TrimRight(chunk, "\r\n")) > maxNDJSONLine {
+			tooLong, n.buf = true, n.buf[:0]
+		}
+		if !tooLong {
+			n.buf = append(n.buf, chunk...)
+		}
+
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case errors.Is(err, io.EOF) && read:
+		case err != nil:
+			return nil, err
+		}
+
+		if tooLong {
+			return nil, errLineTooLong
+		}
+		return n.buf, nil
+	}
+}
+
+// PhoneImportReport tells what an import did, or in a dry run would do.
+type PhoneImportReport struct {
+	DryRun    bool `json:"dry_run"`
+	Rows      int  `json:"rows"`
+	Created   int  `json:"created"`
+	Updated   int  `json:"updated"`
+	Unchanged int  `json:"unchanged"`
+	Failed    int  `json:"failed"`
+	// Errors lists the failed rows, up to a limit when there are many.
+	Errors []ImportRowError `json:"errors"`
+}
+
+type ImportRowError struct {
+	Line   int          `json:"line"`
+	Detail string       `json:"detail"`
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// MaxImportErrors bounds the failed rows a report lists; the others are
+// only counted.
+const MaxImportErrors = 1000
+
+// AddError counts the row as failed for err, which may come from reading
+// the row or from Validate.
+func (r *PhoneImportReport) AddError(line int, err error) {
+	r.Failed++
+	if len(r.Errors) >= MaxImportErrors {
+		return
+	}
+
+	rowErr := ImportRowError{Line: line, Detail: err.Error(), Fields: FieldErrors(err)}
+	if rowErr.Fields != nil {
+		rowErr.Detail = "validation failed"
+	}
+	r.Errors = append(r.Errors, rowErr)
+}
+
+type UpsertOutcome string
+
+const (
+	UpsertCreated   UpsertOutcome = "created"
+	UpsertUpdated   UpsertOutcome = "updated"
+	UpsertUnchanged UpsertOutcome = "unchanged"
+)
+
+// PhoneUpsert is what an upsert did with a phone.
+type PhoneUpsert struct {
+	Outcome UpsertOutcome
+	Phone   Phone
+}
@@ -0,0 +1,211 @@
+package entity
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var ErrPatchTestFailed = errors.New("patch test failed")
+
+// PhonePatch holds the fields a partial update sets. A nil field is left as
+// it is; a field removed by the patch is set to its zero value, which the
+// validation of the merged phone then rejects.
+type PhonePatch struct {
+	Brand     *string `json:"brand,omitempty"`
+	Model     *string `json:"model,omitempty"`
+	Year      *int    `json:"year,omitempty"`
+	OS        *string `json:"os,omitempty"`
+	Processor *string `json:"processor,omitempty"`
+
+	// tests are the test operations of a JSON Patch, in order.
+	tests []patchTest
+}
+
+// patchTest requires the field to have the value once the operations
+// before it are applied.
+type patchTest struct {
+	field  string
+	value  json.RawMessage
+	before PhonePatch
+}
+
+// Empty tells whether the patch changes nothing.
+func (p PhonePatch) Empty() bool {
+	return p.Brand == nil && p.Model == nil && p.Year == nil && p.OS == nil && p.Processor == nil
+}
+
+// Apply merges the patch into the phone. It fails with ErrPatchTestFailed
+// when a JSON Patch test operation doesn't hold.
+func (p PhonePatch) Apply(ph Phone) (PhoneInputDto, error) {
+	in := PhoneInputDto{
+		Brand:     ph.Brand,
+		Model:     ph.Model,
+		Year:      ph.Year,
+		OS:        ph.OS,
+		Processor: ph.Processor,
+	}
+
+	for _, t := range p.tests {
+		got, _ := json.Marshal(t.before.merge(in).field(t.field))
+		if !jsonEqual(got, t.value) {
+			return in, fmt.Errorf("%w: %s is %s", ErrPatchTestFailed, t.field, got)
+		}
+	}
+
+	return p.merge(in), nil
+}
+
+func (p PhonePatch) merge(in PhoneInputDto) PhoneInputDto {
+	if p.Brand != nil {
+		in.Brand = *p.Brand
+	}
+	if p.Model != nil {
+		in.Model = *p.Model
+	}
+	if p.Year != nil {
+		in.Year = *p.Year
+	}
+	if p.OS != nil {
+		in.OS = *p.OS
+	}
+	if p.Processor != nil {
+		in.Processor = *p.Processor
+	}
+
+	return in
+}
+
+func (i PhoneInputDto) field(name string) any {
+	switch name {
+	case "brand":
+		return i.Brand
+	case "model":
+		return i.Model
+	case "year":
+		return i.Year
+	case "os":
+		return i.OS
+	case "processor":
+		return i.Processor
+	}
+
+	return nil
+}
+
+// set sets the field from its JSON value; null removes it.
+func (p *PhonePatch) set(name string, value json.RawMessage) error {
+	var err error
+	switch name {
+	case "brand":
+		p.Brand, err = patchValue[string](value)
+	case "model":
+		p.Model, err = patchValue[string](value)
+	case "year":
+		p.Year, err = patchValue[int](value)
+	case "os":
+		p.OS, err = patchValue[string](value)
+	case "processor":
+		p.Processor, err = patchValue[string](value)
+	default:
+		return fmt.Errorf("unknown field %q", name)
+	}
+	if err != nil {
+		return fmt.Errorf("field %q: %w", name, err)
+	}
+
+	return nil
+}
+
+func patchValue[T any](value json.RawMessage) (*T, error) {
+	v := new(T)
+	if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+		return v, nil
+	}
+
+	return v, json.Unmarshal(value, v)
+}
+
+// ParsePhoneMergePatch parses an RFC 7396 JSON Merge Patch document.
+func ParsePhoneMergePatch(body []byte) (PhonePatch, error) {
+	var patch PhonePatch
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return patch, err
+	}
+
+	for name, value := range doc {
+		if err := patch.set(name, value); err != nil {
+			return patch, err
+		}
+	}
+
+	return patch, nil
+}
+
+// ParsePhoneJSONPatch parses an RFC 6902 JSON Patch document. Phones are
+// flat, so only add, replace, remove and test of top-level fields are
+// supported. The operations apply in order, so a test sees what the
+// operations before it changed.
+func ParsePhoneJSONPatch(body []byte) (PhonePatch, error) {
+	var patch PhonePatch
+
+	var ops []struct {
+		Op    string          `json:"op"`
+		Path  string          `json:"path"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(body, &ops); err != nil {
+		return patch, err
+	}
+
+	for i, op := range ops {
+		field, ok := strings.CutPrefix(op.Path, "/")
+		if !ok || strings.Contains(field, "/") {
+			return patch, fmt.Errorf("operation %d: unsupported path %q", i, op.Path)
+		}
+
+		var err error
+		switch op.Op {
+		case "add", "replace":
+			if op.Value == nil {
+				return patch, fmt.Errorf("operation %d: missing value", i)
+			}
+			err = patch.set(field, op.Value)
+		case "remove":
+			err = patch.set(field, json.RawMessage("null"))
+		case "test":
+			if op.Value == nil {
+				return patch, fmt.Errorf("operation %d: missing value", i)
+			}
+			if (PhoneInputDto{}).field(field) == nil {
+				return patch, fmt.Errorf("operation %d: unknown field %q", i, field)
+			}
+			before := patch
+			before.tests = nil
+			patch.tests = append(patch.tests, patchTest{field: field, value: op.Value, before: before})
+		default:
+			return patch, fmt.Errorf("operation %d: unsupported op %q", i, op.Op)
+		}
+		if err != nil {
+			return patch, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+
+	return patch, nil
+}
+
+// jsonEqual compares JSON values the way RFC 6902 tests do: of the same
+// type, numbers by value.
+func jsonEqual(a, b []byte) bool {
+	var x, y any
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(x, y)
+}
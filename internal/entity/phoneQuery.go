@@ -0,0 +1,133 @@
+package entity
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PhoneSortFields is the whitelist of fields the phone listing can be
+// ordered by. The value tells whether the field holds a number.
+var PhoneSortFields = map[string]bool{
+	"id":        true,
+	"brand":     false,
+	"model":     false,
+	"year":      true,
+	"os":        false,
+	"processor": false,
+}
+
+type PhoneSort struct {
+	Field string
+	Desc  bool
+}
+
+// ParsePhoneSort parses values like "year" or "-year" (descending).
+func ParsePhoneSort(s string) (PhoneSort, error) {
+	if s == "" {
+		return PhoneSort{Field: "id"}, nil
+	}
+
+	sort := PhoneSort{Field: strings.TrimPrefix(s, "-"), Desc: strings.HasPrefix(s, "-")}
+	if _, ok := PhoneSortFields[sort.Field]; !ok {
+		return PhoneSort{}, fmt.Errorf("unknown sort field %q", sort.Field)
+	}
+
+	return sort, nil
+}
+
+func (s PhoneSort) String() string {
+	if s.Desc {
+		return "-" + s.Field
+	}
+
+	return s.Field
+}
+
+// PhoneCursor points right after the last phone of a page: the value of the
+// sort field and the id, which breaks ties.
+type PhoneCursor struct {
+	Sort  string `json:"s"`
+	Value any    `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+func (c PhoneCursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodePhoneCursor(s string, sort PhoneSort) (*PhoneCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+
+	var raw struct {
+		Sort  string          `json:"s"`
+		Value json.RawMessage `json:"v"`
+		ID    int64           `json:"id"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+
+	if raw.Sort != sort.String() {
+		return nil, errors.New("cursor was issued for a different sort order")
+	}
+
+	c := &PhoneCursor{Sort: raw.Sort, ID: raw.ID}
+	if sort.Field == "id" {
+		return c, nil
+	}
+
+	// An empty string is a value like any other; only a missing one makes
+	// the cursor unusable.
+	if len(raw.Value) == 0 || string(raw.Value) == "null" {
+		return nil, errors.New("malformed cursor")
+	}
+
+	if PhoneSortFields[sort.Field] {
+		var v int64
+		err = json.Unmarshal(raw.Value, &v)
+		c.Value = v
+	} else {
+		var v string
+		err = json.Unmarshal(raw.Value, &v)
+		c.Value = v
+	}
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+
+	return c, nil
+}
+
+type PhoneFilter struct {
+	// CreatedBy limits the result to phones created by the user, 0 means
+	// any user.
+	CreatedBy int64
+	Brand     string
+	Model     string
+	OS        string
+	Processor string
+	YearFrom  int
+	YearTo    int
+	// Deleted lists the trash instead of the live phones.
+	Deleted bool
+}
+
+type PhoneQuery struct {
+	PhoneFilter
+	Limit int
+	Sort  PhoneSort
+	After *PhoneCursor
+}
+
+type PhonePage struct {
+	Items      []Phone `json:"items"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	Total      int64   `json:"total"`
+}
@@ -0,0 +1,98 @@
+package entity
+
+import "time"
+
+type RevisionAction string
+
+const (
+	RevisionCreate  RevisionAction = "create"
+	RevisionUpdate  RevisionAction = "update"
+	RevisionDelete  RevisionAction = "delete"
+	RevisionRestore RevisionAction = "restore"
+)
+
+// PhoneSnapshot is the state of a phone a revision records.
+type PhoneSnapshot struct {
+	Brand     string `json:"brand"`
+	Model     string `json:"model"`
+	Year      int    `json:"year"`
+	OS        string `json:"os"`
+	Processor string `json:"processor"`
+	Deleted   bool   `json:"deleted,omitempty"`
+}
+
+func NewPhoneSnapshot(ph Phone) PhoneSnapshot {
+	return PhoneSnapshot{
+		Brand:     ph.Brand,
+		Model:     ph.Model,
+		Year:      ph.Year,
+		OS:        ph.OS,
+		Processor: ph.Processor,
+		Deleted:   ph.DeletedAt != nil,
+	}
+}
+
+// Input is what an update has to send to bring a phone back to the snapshot.
+func (s PhoneSnapshot) Input() PhoneInputDto {
+	return PhoneInputDto{
+		Brand:     s.Brand,
+		Model:     s.Model,
+		Year:      s.Year,
+		OS:        s.OS,
+		Processor: s.Processor,
+	}
+}
+
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// PhoneRevision is an immutable record of one change of a phone. Revision is
+// the version the phone got with the change.
+type PhoneRevision struct {
+	PhoneID   int64          `json:"phone_id"`
+	Revision  int64          `json:"revision"`
+	Action    RevisionAction `json:"action"`
+	ActorID   *int64         `json:"actor_id"`
+	CreatedAt time.Time      `json:"created_at"`
+	Before    *PhoneSnapshot `json:"before"`
+	After     *PhoneSnapshot `json:"after"`
+	Changes   []FieldChange  `json:"changes"`
+}
+
+// DiffPhoneSnapshots lists the fields that differ. A nil snapshot stands
+// for a phone that doesn't exist, so every field of the other one counts.
+func DiffPhoneSnapshots(before, after *PhoneSnapshot) []FieldChange {
+	var from, to PhoneSnapshot
+	if before != nil {
+		from = *before
+	}
+	if after != nil {
+		to = *after
+	}
+
+	changes := make([]FieldChange, 0)
+	add := func(field string, a, b any) {
+		switch {
+		case before == nil:
+			changes = append(changes, FieldChange{Field: field, To: b})
+		case after == nil:
+			changes = append(changes, FieldChange{Field: field, From: a})
+		case a != b:
+			changes = append(changes, FieldChange{Field: field, From: a, To: b})
+		}
+	}
+
+	add("brand", from.Brand, to.Brand)
+	add("model", from.Model, to.Model)
+	add("year", from.Year, to.Year)
+	add("os", from.OS, to.OS)
+	add("processor", from.Processor, to.Processor)
+	if before != nil && after != nil && from.Deleted != to.Deleted {
+		changes = append(changes, FieldChange{Field: "deleted", From: from.Deleted, To: to.Deleted})
+	}
+
+	return changes
+}
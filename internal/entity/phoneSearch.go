@@ -0,0 +1,35 @@
+package entity
+
+import (
+	"strings"
+	"unicode"
+)
+
+// PhoneSearchQuery is a free text search over the brand, model, OS and
+// processor of the live phones.
+type PhoneSearchQuery struct {
+	Text  string
+	Limit int
+}
+
+// Terms splits the text into the lower-cased words it looks for.
+func (q PhoneSearchQuery) Terms() []string {
+	return strings.FieldsFunc(strings.ToLower(q.Text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+type PhoneSearchHit struct {
+	Phone Phone   `json:"phone"`
+	Rank  float64 `json:"rank"`
+	// Highlights holds the matching fields by name, HTML-escaped with the
+	// matched words wrapped in <mark> tags.
+	Highlights map[string]string `json:"highlights"`
+}
+
+type PhoneSearchResult struct {
+	Items []PhoneSearchHit `json:"items"`
+	// Fuzzy tells that no phone matched the words as typed, and the items
+	// are the closest spellings instead.
+	Fuzzy bool `json:"fuzzy"`
+}
@@ -0,0 +1,17 @@
+package entity
+
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleAdmin  Role = "admin"
+)
+
+type RoleInput struct {
+	Role Role `json:"role" validate:"required,oneof=viewer editor admin"`
+}
+
+func (i RoleInput) Validate() error {
+	return validate.Struct(i)
+}
@@ -0,0 +1,10 @@
+package entity
+
+// SuggestFields are the phone fields with typeahead suggestions.
+var SuggestFields = []string{"brand", "model", "processor"}
+
+// Suggestion is a value of a field and the number of live phones having it.
+type Suggestion struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
@@ -0,0 +1,41 @@
+package entity
+
+import "time"
+
+type Tokens struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshToken is the server side record of an issued refresh token. Only
+// the hash of the token is stored; every token obtained by rotation shares
+// the FamilyID of the one issued at sign in.
+type RefreshToken struct {
+	ID        int64
+	UserID    int64
+	TokenHash string
+	FamilyID  string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+func (i RefreshInput) Validate() error {
+	return validate.Struct(i)
+}
+
+// AccessClaims is what the service vouches for after checking an access
+// token. SessionID is the refresh token family the token was issued with.
+type AccessClaims struct {
+	UserID    int64
+	Role      Role
+	TokenID   string
+	SessionID string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
@@ -10,13 +10,15 @@ var validate *validator.Validate
 
 func init() {
 	validate = validator.New()
+	registerValidations(validate)
 }
 
 type User struct {
 	ID           int64     `json:"id"`
 	Name         string    `json:"name"`
 	Email        string    `json:"email"`
-	Password     string    `json:"password"`
+	Password     string    `json:"-"`
+	Role         Role      `json:"role"`
 	RegisteredAt time.Time `json:"registered_at"`
 }
 
@@ -0,0 +1,135 @@
+package entity
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/ru"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	enTranslations "github.com/go-playground/validator/v10/translations/en"
+	ruTranslations "github.com/go-playground/validator/v10/translations/ru"
+)
+
+// FirstPhoneYear is when the first handheld mobile phone was demonstrated.
+const FirstPhoneYear = 1973
+
+// PhoneOSFamilies is the set of operating systems a phone may run. The OS
+// field holds one of them, optionally followed by a version.
+var PhoneOSFamilies = []string{
+	"Android",
+	"iOS",
+	"iPadOS",
+	"HarmonyOS",
+	"KaiOS",
+	"Tizen",
+	"Sailfish OS",
+	"Ubuntu Touch",
+	"Windows Phone",
+	"Windows Mobile",
+	"BlackBerry OS",
+	"Symbian",
+	"webOS",
+	"Firefox OS",
+}
+
+var translator *ut.UniversalTranslator
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// jsonFieldName makes validation errors name fields the way clients send
+// them.
+func jsonFieldName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	if name == "-" {
+		return ""
+	}
+
+	return name
+}
+
+func registerValidations(v *validator.Validate) {
+	v.RegisterTagNameFunc(jsonFieldName)
+
+	v.RegisterValidation("phoneyear", func(fl validator.FieldLevel) bool {
+		year := fl.Field().Int()
+		return year >= FirstPhoneYear && year <= int64(time.Now().Year()+1)
+	})
+
+	v.RegisterValidation("phoneos", func(fl validator.FieldLevel) bool {
+		os := strings.ToLower(fl.Field().String())
+		for _, family := range PhoneOSFamilies {
+			family = strings.ToLower(family)
+			if os == family || strings.HasPrefix(os, family+" ") {
+				return true
+			}
+		}
+
+		return false
+	})
+
+	english, russian := en.New(), ru.New()
+	translator = ut.New(english, english, russian)
+
+	enTrans, _ := translator.GetTranslator("en")
+	enTranslations.RegisterDefaultTranslations(v, enTrans)
+	registerTranslation(v, enTrans, "phoneyear", "{0} must be between {1} and {2}")
+	registerTranslation(v, enTrans, "phoneos", "{0} must start with one of: {1}")
+
+	ruTrans, _ := translator.GetTranslator("ru")
+	ruTranslations.RegisterDefaultTranslations(v, ruTrans)
+	registerTranslation(v, ruTrans, "phoneyear", "{0} должен быть от {1} до {2}")
+	registerTranslation(v, ruTrans, "phoneos", "{0} должен начинаться с одного из: {1}")
+}
+
+func registerTranslation(v *validator.Validate, trans ut.Translator, tag, text string) {
+	v.RegisterTranslation(tag, trans, func(trans ut.Translator) error {
+		return trans.Add(tag, text, true)
+	}, func(trans ut.Translator, fe validator.FieldError) string {
+		var msg string
+		switch fe.Tag() {
+		case "phoneyear":
+			msg, _ = trans.T(tag, fe.Field(), strconv.Itoa(FirstPhoneYear), strconv.Itoa(time.Now().Year()+1))
+		case "phoneos":
+			msg, _ = trans.T(tag, fe.Field(), strings.Join(PhoneOSFamilies, ", "))
+		default:
+			msg, _ = trans.T(tag, fe.Field())
+		}
+
+		return msg
+	})
+}
+
+// FieldErrors lists the fields rejected by a Validate method with messages
+// in the first of the locales that is supported, English by default. It
+// returns nil when err doesn't come from a Validate method.
+func FieldErrors(err error, locales ...string) []FieldError {
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+
+	trans, _ := translator.FindTranslator(locales...)
+
+	fields := make([]FieldError, 0, len(errs))
+	for _, e := range errs {
+		fields = append(fields, FieldError{
+			Field:   e.Field(),
+			Code:    e.Tag(),
+			Message: e.Translate(trans),
+		})
+	}
+
+	return fields
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type RevocationStore interface {
+	RevokeToken(ctx context.Context, tokenID string, userID int64, expiresAt time.Time) error
+	RevokeUserTokens(ctx context.Context, userID int64, before, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, tokenID string, userID int64, issuedAt time.Time) (bool, error)
+	PurgeExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type userCutoff struct {
+	before    time.Time
+	expiresAt time.Time
+}
+
+// Revocations keeps revocations in process memory in front of a shared
+// store. A revocation is final, so revoked answers are kept until the token
+// would have expired anyway. "Not revoked" answers are only kept for
+// negativeTtl, which bounds how long a logout made on another replica can
+// go unnoticed here.
+type Revocations struct {
+	store       RevocationStore
+	negativeTtl time.Duration
+
+	mu     sync.RWMutex
+	tokens map[string]time.Time
+	users  map[int64]userCutoff
+	valid  map[string]time.Time
+}
+
+func NewRevocation(store RevocationStore, negativeTtl time.Duration) *Revocations {
+	return &Revocations{
+		store:       store,
+		negativeTtl: negativeTtl,
+		tokens:      make(map[string]time.Time),
+		users:       make(map[int64]userCutoff),
+		valid:       make(map[string]time.Time),
+	}
+}
+
+func (r *Revocations) RevokeToken(ctx context.Context, tokenID string, userID int64, expiresAt time.Time) error {
+	if err := r.store.RevokeToken(ctx, tokenID, userID, expiresAt); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.tokens[tokenID] = expiresAt
+	delete(r.valid, tokenID)
+	r.mu.Unlock()
+
+	return nil
+}
+
+func (r *Revocations) RevokeUserTokens(ctx context.Context, userID int64, before, expiresAt time.Time) error {
+	if err := r.store.RevokeUserTokens(ctx, userID, before, expiresAt); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	if cur, ok := r.users[userID]; !ok || before.After(cur.before) {
+		r.users[userID] = userCutoff{before: before, expiresAt: expiresAt}
+	}
+	r.valid = make(map[string]time.Time)
+	r.mu.Unlock()
+
+	return nil
+}
+
+func (r *Revocations) IsRevoked(ctx context.Context, tokenID string, userID int64, issuedAt time.Time) (bool, error) {
+	now := time.Now()
+
+	r.mu.RLock()
+	expiresAt, revoked := r.tokens[tokenID]
+	cutoff, cut := r.users[userID]
+	validUntil, valid := r.valid[tokenID]
+	r.mu.RUnlock()
+
+	if revoked && now.Before(expiresAt) {
+		return true, nil
+	}
+	if cut && now.Before(cutoff.expiresAt) && !issuedAt.After(cutoff.before) {
+		return true, nil
+	}
+	if valid && now.Before(validUntil) {
+		return false, nil
+	}
+
+	isRevoked, err := r.store.IsRevoked(ctx, tokenID, userID, issuedAt)
+	if err != nil {
+		return false, err
+	}
+
+	if !isRevoked && r.negativeTtl > 0 {
+		r.mu.Lock()
+		r.valid[tokenID] = now.Add(r.negativeTtl)
+		r.mu.Unlock()
+	}
+
+	return isRevoked, nil
+}
+
+// PurgeExpired drops entries for tokens that have expired by now, both from
+// memory and from the underlying store.
+func (r *Revocations) PurgeExpired(ctx context.Context, now time.Time) (int64, error) {
+	r.mu.Lock()
+	for id, expiresAt := range r.tokens {
+		if !now.Before(expiresAt) {
+			delete(r.tokens, id)
+		}
+	}
+	for id, cutoff := range r.users {
+		if !now.Before(cutoff.expiresAt) {
+			delete(r.users, id)
+		}
+	}
+	for id, validUntil := range r.valid {
+		if !now.Before(validUntil) {
+			delete(r.valid, id)
+		}
+	}
+	r.mu.Unlock()
+
+	return r.store.PurgeExpired(ctx, now)
+}
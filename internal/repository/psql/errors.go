@@ -0,0 +1,21 @@
+package psql
+
+import (
+	"crud-go/internal/entity"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+const uniqueViolation = "23505"
+
+// mapError turns driver errors the services care about into entity errors.
+func mapError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return fmt.Errorf("%w: %s", entity.ErrDuplicate, pqErr.Constraint)
+	}
+
+	return err
+}
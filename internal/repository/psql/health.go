@@ -0,0 +1,23 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Health reports whether the database answers.
+type Health struct {
+	db *sql.DB
+}
+
+func NewHealth(db *sql.DB) *Health {
+	return &Health{db: db}
+}
+
+func (h *Health) Name() string {
+	return "postgres"
+}
+
+func (h *Health) Check(ctx context.Context) error {
+	return h.db.PingContext(ctx)
+}
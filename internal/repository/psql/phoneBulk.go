@@ -0,0 +1,113 @@
+package psql
+
+import (
+	"context"
+	"crud-go/internal/entity"
+	"fmt"
+)
+
+// bulkChunkSize is the number of phones one INSERT creates, which bounds
+// the work a failed chunk retries phone by phone.
+const bulkChunkSize = 1000
+
+// BulkWritePhones runs the operations in order in one transaction; runs of
+// creates are inserted by chunks of multi-row INSERTs. When atomic, the
+// first failing operation rolls back all of them and is returned as
+// *entity.BulkOpError. Otherwise a failure only undoes its own operation
+// and is reported in its result.
+func (p *Phones) BulkWritePhones(ctx context.Context, userID int64, ops []entity.PhoneBulkOp, atomic bool) ([]entity.PhoneBulkResult, error) {
+	results := make([]entity.PhoneBulkResult, len(ops))
+	for i, op := range ops {
+		results[i] = entity.PhoneBulkResult{Index: i, Action: op.Action, ID: op.ID}
+	}
+
+	err := p.db.inTx(ctx, func(tx *tracedTx) error {
+		for i := 0; i < len(ops); {
+			j := i + 1
+			if ops[i].Action == entity.BulkCreate {
+				for j < len(ops) && j-i < bulkChunkSize && ops[j].Action == entity.BulkCreate {
+					j++
+				}
+			}
+
+			if err := bulkWrite(ctx, tx, userID, ops[i:j], results[i:j], atomic); err != nil {
+				return err
+			}
+			i = j
+		}
+
+		return nil
+	})
+
+	return results, err
+}
+
+// bulkWrite runs an update, a delete or a chunk of creates. A failed chunk
+// is retried phone by phone to find out which ones fail.
+func bulkWrite(ctx context.Context, tx *tracedTx, userID int64, ops []entity.PhoneBulkOp, results []entity.PhoneBulkResult, atomic bool) error {
+	// A failing single operation ends an atomic write anyway, so it needs
+	// no savepoint.
+	if atomic && len(ops) == 1 {
+		if err := applyBulkOps(ctx, tx, userID, ops, results); err != nil {
+			return &entity.BulkOpError{Index: results[0].Index, Err: err}
+		}
+		return nil
+	}
+
+	opErr, err := tx.inSavepoint(ctx, func() error {
+		return applyBulkOps(ctx, tx, userID, ops, results)
+	})
+	if err != nil || opErr == nil {
+		return err
+	}
+
+	if len(ops) > 1 {
+		for k := range ops {
+			if err := bulkWrite(ctx, tx, userID, ops[k:k+1], results[k:k+1], atomic); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	results[0].Err = opErr
+	return nil
+}
+
+// applyBulkOps runs ops, which are all creates or a single other operation,
+// and fills in their results.
+func applyBulkOps(ctx context.Context, tx *tracedTx, userID int64, ops []entity.PhoneBulkOp, results []entity.PhoneBulkResult) error {
+	op := ops[0]
+	switch op.Action {
+	case entity.BulkCreate:
+		inputs := make([]entity.PhoneInputDto, len(ops))
+		for k, op := range ops {
+			inputs[k] = *op.Phone
+		}
+
+		created, err := insertPhones(ctx, tx, userID, inputs)
+		if err != nil {
+			return err
+		}
+		for k := range created {
+			results[k].ID = int64(created[k].Id)
+			results[k].Phone = &created[k]
+		}
+	case entity.BulkUpdate:
+		updated, err := updatePhone(ctx, tx, userID, op.ID, op.IfMatch(), inputSet(*op.Phone))
+		if err != nil {
+			return err
+		}
+		results[0].Phone = &updated
+	case entity.BulkDelete:
+		deleted, err := deletePhone(ctx, tx, userID, op.ID, op.IfMatch())
+		if err != nil {
+			return err
+		}
+		results[0].Phone = &deleted
+	default:
+		return fmt.Errorf("unknown bulk action %q", op.Action)
+	}
+
+	return nil
+}
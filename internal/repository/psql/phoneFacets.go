@@ -0,0 +1,101 @@
+package psql
+
+import (
+	"cmp"
+	"context"
+	"crud-go/internal/entity"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var phoneFacetColumns = map[string]string{
+	"brand":     "brand",
+	"os":        "os",
+	"processor": "processor",
+	"year":      "year",
+}
+
+// GetPhoneFacets counts the phones matching the filter by every requested
+// field in one query, a grouping set per field.
+func (p *Phones) GetPhoneFacets(ctx context.Context, q entity.PhoneFacetQuery) (entity.PhoneFacets, error) {
+	facets := entity.PhoneFacets{Facets: make(map[string][]entity.FacetBucket, len(q.Fields))}
+
+	columns := make([]string, 0, len(q.Fields)+1)
+	sets := make([]string, 0, len(q.Fields)+1)
+	for _, field := range q.Fields {
+		column, ok := phoneFacetColumns[field]
+		if !ok {
+			return facets, fmt.Errorf("unknown facet field %q", field)
+		}
+		if field == "year" {
+			column = fmt.Sprintf("year / %d * %d", q.YearInterval, q.YearInterval)
+		}
+
+		columns = append(columns, column)
+		sets = append(sets, "("+column+")")
+		facets.Facets[field] = make([]entity.FacetBucket, 0)
+	}
+	// The empty set counts all the phones.
+	sets = append(sets, "()")
+
+	where := phoneFilter(q.PhoneFilter)
+	rows, err := p.db.QueryContext(ctx, "SELECT "+strings.Join(append(columns, "count(*)"), ", ")+
+		" FROM phones"+where.String()+" GROUP BY GROUPING SETS ("+strings.Join(sets, ", ")+")", where.args...)
+	if err != nil {
+		return facets, err
+	}
+	defer rows.Close()
+
+	values := make([]sql.NullString, len(columns))
+	var count int64
+	dest := make([]any, 0, len(columns)+1)
+	for i := range values {
+		dest = append(dest, &values[i])
+	}
+	dest = append(dest, &count)
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return facets, err
+		}
+
+		// The columns are NOT NULL, so the one that isn't null is the field
+		// the row counts by. None means the row of the empty set.
+		i := slices.IndexFunc(values, func(v sql.NullString) bool { return v.Valid })
+		if i < 0 {
+			facets.Total = count
+			continue
+		}
+
+		field := q.Fields[i]
+		bucket := entity.FacetBucket{Count: count}
+		if field == "year" {
+			from, err := strconv.Atoi(values[i].String)
+			if err != nil {
+				return facets, err
+			}
+			bucket.From, bucket.To = from, from+q.YearInterval-1
+		} else {
+			bucket.Value = values[i].String
+		}
+		facets.Facets[field] = append(facets.Facets[field], bucket)
+	}
+	if err := rows.Err(); err != nil {
+		return facets, err
+	}
+
+	for field, buckets := range facets.Facets {
+		if field == "year" {
+			slices.SortFunc(buckets, func(a, b entity.FacetBucket) int { return cmp.Compare(a.From, b.From) })
+			continue
+		}
+		slices.SortFunc(buckets, func(a, b entity.FacetBucket) int {
+			return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Value, b.Value))
+		})
+	}
+
+	return facets, nil
+}
@@ -0,0 +1,140 @@
+package psql
+
+import (
+	"context"
+	"crud-go/internal/entity"
+	"fmt"
+	"strings"
+)
+
+// importLock is the advisory lock that serializes upserts, so that two of
+// them can't both create a phone with the same natural key.
+const importLock = 7_118_260_541
+
+var phoneKeyColumns = map[string]string{
+	"brand":     "lower(brand)",
+	"model":     "lower(model)",
+	"year":      "year",
+	"os":        "lower(os)",
+	"processor": "lower(processor)",
+}
+
+// UpsertPhones creates the phones, or updates the live phones with the same
+// natural key; key fields of text are compared ignoring case. When several
+// phones share a key, the oldest one is updated. The natural keys of phs
+// must be distinct. With dryRun nothing is written and the outcomes only
+// tell what would happen; the phones of created outcomes are then empty.
+func (p *Phones) UpsertPhones(ctx context.Context, userID int64, key []string, phs []entity.PhoneInputDto, dryRun bool) ([]entity.PhoneUpsert, error) {
+	results := make([]entity.PhoneUpsert, len(phs))
+
+	err := p.db.inTx(ctx, func(tx *tracedTx) error {
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", importLock); err != nil {
+			return err
+		}
+
+		existing, err := lockPhonesByKey(ctx, tx, key, phs)
+		if err != nil {
+			return err
+		}
+
+		var inserts []entity.PhoneInputDto
+		var insertedAt []int
+		for i, ph := range phs {
+			current, ok := existing[entity.PhoneNaturalKey(key, ph)]
+			switch {
+			case !ok:
+				inserts = append(inserts, ph)
+				insertedAt = append(insertedAt, i)
+				results[i].Outcome = entity.UpsertCreated
+			case entity.NewPhoneSnapshot(current).Input() == ph:
+				results[i] = entity.PhoneUpsert{Outcome: entity.UpsertUnchanged, Phone: current}
+			case dryRun:
+				results[i] = entity.PhoneUpsert{Outcome: entity.UpsertUpdated, Phone: current}
+			default:
+				updated, err := updatePhone(ctx, tx, userID, int64(current.Id), nil, inputSet(ph))
+				if err != nil {
+					return err
+				}
+				results[i] = entity.PhoneUpsert{Outcome: entity.UpsertUpdated, Phone: updated}
+			}
+		}
+
+		if len(inserts) > 0 && !dryRun {
+			created, err := insertPhones(ctx, tx, userID, inserts)
+			if err != nil {
+				return err
+			}
+			for k, i := range insertedAt {
+				results[i].Phone = created[k]
+			}
+		}
+
+		return nil
+	})
+
+	return results, err
+}
+
+// lockPhonesByKey reads the live phones having the natural key of one of
+// phs for update, by key.
+func lockPhonesByKey(ctx context.Context, tx *tracedTx, key []string, phs []entity.PhoneInputDto) (map[string]entity.Phone, error) {
+	columns := make([]string, len(key))
+	for i, field := range key {
+		column, ok := phoneKeyColumns[field]
+		if !ok {
+			return nil, fmt.Errorf("unknown natural key field %q", field)
+		}
+		columns[i] = column
+	}
+
+	values := new(valuesClause)
+	for _, ph := range phs {
+		row := make([]any, len(key))
+		for i, field := range key {
+			row[i] = phoneKeyValue(ph, field)
+		}
+		values.add(row...)
+	}
+
+	// The values are lowered in Go so that they match the keys built from
+	// the phones read back.
+	rows, err := tx.QueryContext(ctx, "SELECT "+phoneColumns+" FROM phones"+
+		" WHERE deleted_at IS NULL AND ("+strings.Join(columns, ", ")+") IN ("+values.list()+")"+
+		" ORDER BY id FOR UPDATE", values.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := make(map[string]entity.Phone)
+	for rows.Next() {
+		ph, err := scanPhone(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		k := entity.PhoneNaturalKey(key, entity.NewPhoneSnapshot(ph).Input())
+		if _, ok := existing[k]; !ok {
+			existing[k] = ph
+		}
+	}
+
+	return existing, rows.Err()
+}
+
+func phoneKeyValue(ph entity.PhoneInputDto, field string) any {
+	switch field {
+	case "brand":
+		return strings.ToLower(ph.Brand)
+	case "model":
+		return strings.ToLower(ph.Model)
+	case "year":
+		return ph.Year
+	case "os":
+		return strings.ToLower(ph.OS)
+	case "processor":
+		return strings.ToLower(ph.Processor)
+	}
+
+	return nil
+}
@@ -4,60 +4,416 @@ import (
 	"context"
 	"crud-go/internal/entity"
 	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 type Phones struct {
-	db *sql.DB
+	db *tracedDB
 }
 
 func NewPhone(db *sql.DB) *Phones {
-	return &Phones{db: db}
+	return &Phones{db: traced(db)}
 }
 
-func (p *Phones) GetPhoneById(ctx context.Context, id int64) (entity.Phone, error) {
+const phoneColumns = "id, brand, model, year, os, processor, created_by, updated_by, created_at, updated_at, version, deleted_at, deleted_by"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPhone(row rowScanner) (entity.Phone, error) {
 	var ph entity.Phone
-	err := p.db.QueryRow("SELECT * FROM phones WHERE id = $1", id).
-		Scan(&ph.Id, &ph.Brand, &ph.Model, &ph.Year, &ph.OS, &ph.Processor)
+	err := row.Scan(&ph.Id, &ph.Brand, &ph.Model, &ph.Year, &ph.OS, &ph.Processor,
+		&ph.CreatedBy, &ph.UpdatedBy, &ph.CreatedAt, &ph.UpdatedAt, &ph.Version,
+		&ph.DeletedAt, &ph.DeletedBy)
+
+	return ph, err
+}
+
+func (p *Phones) GetPhoneById(ctx context.Context, id int64) (entity.Phone, error) {
+	return scanPhone(p.db.QueryRowContext(ctx, "SELECT "+phoneColumns+" FROM phones WHERE id = $1 AND deleted_at IS NULL", id))
+}
+
+// GetPhonesByIds reads the live phones with the ids, in no particular
+// order; missing ids are left out.
+func (p *Phones) GetPhonesByIds(ctx context.Context, ids []int64) ([]entity.Phone, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT "+phoneColumns+" FROM phones WHERE id = ANY($1) AND deleted_at IS NULL", pq.Array(ids))
 	if err != nil {
-		return ph, err
+		return nil, err
 	}
+	defer rows.Close()
 
-	return ph, nil
+	var phones []entity.Phone
+	for rows.Next() {
+		ph, err := scanPhone(rows)
+		if err != nil {
+			return nil, err
+		}
+		phones = append(phones, ph)
+	}
+
+	return phones, rows.Err()
 }
 
-func (p *Phones) GetAllPhones(ctx context.Context) ([]entity.Phone, error) {
-	var phones []entity.Phone
+func (p *Phones) GetAllPhones(ctx context.Context, q entity.PhoneQuery) (entity.PhonePage, error) {
+	var page entity.PhonePage
 
-	rows, err := p.db.Query("SELECT * FROM phones")
+	column, ok := phoneSortColumns[q.Sort.Field]
+	if !ok {
+		return page, fmt.Errorf("unknown sort field %q", q.Sort.Field)
+	}
+
+	where := phoneFilter(q.PhoneFilter)
+	err := p.db.QueryRowContext(ctx, "SELECT count(*) FROM phones"+where.String(), where.args...).Scan(&page.Total)
 	if err != nil {
-		return phones, err
+		return page, err
+	}
+
+	cmp, order := ">", "ASC"
+	if q.Sort.Desc {
+		cmp, order = "<", "DESC"
 	}
 
+	if q.After != nil {
+		if column == "id" {
+			where.add("id "+cmp+" ?", q.After.ID)
+		} else {
+			where.add("("+column+", id) "+cmp+" (?, ?)", q.After.Value, q.After.ID)
+		}
+	}
+
+	orderBy := " ORDER BY " + column + " " + order
+	if column != "id" {
+		orderBy += ", id " + order
+	}
+
+	// One extra row tells whether there is a next page.
+	rows, err := p.db.QueryContext(ctx, "SELECT "+phoneColumns+" FROM phones"+
+		where.String()+orderBy+fmt.Sprintf(" LIMIT %d", q.Limit+1), where.args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	page.Items = make([]entity.Phone, 0, q.Limit)
 	for rows.Next() {
-		var ph entity.Phone
-		err := rows.Scan(&ph.Id, &ph.Brand, &ph.Model, &ph.Year, &ph.OS, &ph.Processor)
+		ph, err := scanPhone(rows)
 		if err != nil {
-			return phones, err
+			return page, err
 		}
-		phones = append(phones, ph)
+		page.Items = append(page.Items, ph)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	if len(page.Items) > q.Limit {
+		page.Items = page.Items[:q.Limit]
+		last := page.Items[q.Limit-1]
+		page.NextCursor = entity.PhoneCursor{
+			Sort:  q.Sort.String(),
+			Value: phoneSortValue(last, q.Sort.Field),
+			ID:    int64(last.Id),
+		}.Encode()
+	}
+
+	return page, nil
+}
+
+var phoneSortColumns = map[string]string{
+	"id":        "id",
+	"brand":     "brand",
+	"model":     "model",
+	"year":      "year",
+	"os":        "os",
+	"processor": "processor",
+}
+
+func phoneSortValue(ph entity.Phone, field string) any {
+	switch field {
+	case "brand":
+		return ph.Brand
+	case "model":
+		return ph.Model
+	case "year":
+		return ph.Year
+	case "os":
+		return ph.OS
+	case "processor":
+		return ph.Processor
+	}
+
+	return nil
+}
+
+func phoneFilter(f entity.PhoneFilter) *whereClause {
+	where := new(whereClause)
+
+	if f.Deleted {
+		where.add("deleted_at IS NOT NULL")
+	} else {
+		where.add("deleted_at IS NULL")
+	}
+	if f.CreatedBy != 0 {
+		where.add("created_by = ?", f.CreatedBy)
+	}
+	if f.Brand != "" {
+		where.add("lower(brand) = lower(?)", f.Brand)
+	}
+	if f.Model != "" {
+		where.add("lower(model) = lower(?)", f.Model)
+	}
+	if f.OS != "" {
+		where.add("lower(os) = lower(?)", f.OS)
+	}
+	if f.Processor != "" {
+		where.add("lower(processor) = lower(?)", f.Processor)
+	}
+	if f.YearFrom != 0 {
+		where.add("year >= ?", f.YearFrom)
+	}
+	if f.YearTo != 0 {
+		where.add("year <= ?", f.YearTo)
+	}
+
+	return where
+}
+
+// Every write below records a revision in the same transaction, so the
+// history can't miss a change.
+
+func (p *Phones) CreatePhone(ctx context.Context, userID int64, ph entity.PhoneInputDto) (entity.Phone, error) {
+	var created []entity.Phone
+	err := p.db.inTx(ctx, func(tx *tracedTx) error {
+		var err error
+		created, err = insertPhones(ctx, tx, userID, []entity.PhoneInputDto{ph})
+		return err
+	})
+	if err != nil {
+		return entity.Phone{}, err
+	}
+
+	return created[0], nil
+}
+
+// insertPhones creates the phones with a single INSERT and returns them in
+// the same order. RETURNING has no order of its own, so the ids are drawn
+// beforehand and every row comes back with the ordinal of its phone.
+func insertPhones(ctx context.Context, tx *tracedTx, userID int64, phs []entity.PhoneInputDto) ([]entity.Phone, error) {
+	n := len(phs)
+	brands, models, oses, processors := make([]string, n), make([]string, n), make([]string, n), make([]string, n)
+	years := make([]int64, n)
+	for i, ph := range phs {
+		brands[i], models[i], oses[i], processors[i] = ph.Brand, ph.Model, ph.OS, ph.Processor
+		years[i] = int64(ph.Year)
+	}
+
+	rows, err := tx.QueryContext(ctx, `WITH input AS (
+			SELECT nextval(pg_get_serial_sequence('phones', 'id')) AS id, t.*
+			FROM unnest($1::text[], $2::text[], $3::int[], $4::text[], $5::text[])
+				WITH ORDINALITY AS t (brand, model, year, os, processor, ord)
+		), inserted AS (
+			INSERT INTO phones (id, brand, model, year, os, processor, created_by, updated_by)
+			SELECT id, brand, model, year, os, processor, $6::bigint, $6::bigint FROM input
+			ORDER BY ord
+			RETURNING `+phoneColumns+`
+		)
+		SELECT inserted.*, input.ord FROM inserted JOIN input USING (id)`,
+		pq.Array(brands), pq.Array(models), pq.Array(years), pq.Array(oses), pq.Array(processors), nullableID(userID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	created := make([]entity.Phone, n)
+	returned := 0
+	for rows.Next() {
+		var ord int
+		ph, err := scanPhone(withExtra{rows, []any{&ord}})
+		if err != nil {
+			return nil, err
+		}
+		if ord < 1 || ord > n {
+			return nil, fmt.Errorf("inserted phone %d has ordinal %d of %d", ph.Id, ord, n)
+		}
+		created[ord-1] = ph
+		returned++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if returned != n {
+		return nil, fmt.Errorf("inserted %d phones of %d", returned, n)
+	}
+
+	revisions := new(valuesClause)
+	for i := range created {
+		if err := addRevision(revisions, entity.RevisionCreate, userID, nil, &created[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return created, insertRevisions(ctx, tx, revisions)
+}
+
+// UpdatePhoneById overwrites the phone and returns it as stored afterwards.
+// When ifMatch isn't empty the phone must be at one of its versions,
+// otherwise entity.ErrVersionMismatch is returned.
+func (p *Phones) UpdatePhoneById(ctx context.Context, userID, id int64, ifMatch []int64, ph entity.PhoneInputDto) (entity.Phone, error) {
+	return p.update(ctx, userID, id, ifMatch, inputSet(ph))
+}
+
+func inputSet(ph entity.PhoneInputDto) *setClause {
+	set := new(setClause)
+	set.add("brand", ph.Brand)
+	set.add("model", ph.Model)
+	set.add("year", ph.Year)
+	set.add("os", ph.OS)
+	set.add("processor", ph.Processor)
+
+	return set
+}
+
+// PatchPhoneById sets only the fields of the patch and returns the phone as
+// stored afterwards. ifMatch works as for UpdatePhoneById.
+func (p *Phones) PatchPhoneById(ctx context.Context, userID, id int64, ifMatch []int64, patch entity.PhonePatch) (entity.Phone, error) {
+	set := new(setClause)
+	if patch.Brand != nil {
+		set.add("brand", *patch.Brand)
+	}
+	if patch.Model != nil {
+		set.add("model", *patch.Model)
+	}
+	if patch.Year != nil {
+		set.add("year", *patch.Year)
+	}
+	if patch.OS != nil {
+		set.add("os", *patch.OS)
+	}
+	if patch.Processor != nil {
+		set.add("processor", *patch.Processor)
 	}
 
-	return phones, nil
+	return p.update(ctx, userID, id, ifMatch, set)
 }
 
-func (p *Phones) CreatePhone(ctx context.Context, ph entity.PhoneInputDto) error {
-	_, err := p.db.Exec("INSERT INTO phones (brand, model, year, os, processor) VALUES ($1, $2, $3, $4, $5)",
-		ph.Brand, ph.Model, ph.Year, ph.OS, ph.Processor)
-	return err
+func (p *Phones) update(ctx context.Context, userID, id int64, ifMatch []int64, set *setClause) (entity.Phone, error) {
+	var updated entity.Phone
+	err := p.db.inTx(ctx, func(tx *tracedTx) error {
+		var err error
+		updated, err = updatePhone(ctx, tx, userID, id, ifMatch, set)
+		return err
+	})
+
+	return updated, err
 }
 
-func (p *Phones) UpdatePhoneById(ctx context.Context, id int64, ph entity.PhoneInputDto) error {
-	_, err := p.db.Exec("UPDATE phones SET brand=$1, model=$2, year=$3, os=$4, processor=$5 WHERE id=$6",
-		ph.Brand, ph.Model, ph.Year, ph.OS, ph.Processor, id)
-	return err
+func updatePhone(ctx context.Context, tx *tracedTx, userID, id int64, ifMatch []int64, set *setClause) (entity.Phone, error) {
+	set.add("updated_by", nullableID(userID))
+	set.addExpr("updated_at = now()")
+	set.addExpr("version = version + 1")
+
+	before, err := lockPhone(ctx, tx, id, false, ifMatch)
+	if err != nil {
+		return before, err
+	}
+
+	updated, err := scanPhone(tx.QueryRowContext(ctx, "UPDATE phones"+set.String()+
+		" WHERE id = "+set.arg(id)+" RETURNING "+phoneColumns, set.args...))
+	if err != nil {
+		return updated, err
+	}
+
+	return updated, recordRevision(ctx, tx, entity.RevisionUpdate, userID, &before, &updated)
 }
 
-func (p *Phones) DeletePhoneById(ctx context.Context, id int64) error {
-	_, err := p.db.Exec("DELETE FROM phones WHERE id = $1", id)
-	return err
+// DeletePhoneById moves the phone to the trash and returns it as it is
+// there. ifMatch works as for UpdatePhoneById.
+func (p *Phones) DeletePhoneById(ctx context.Context, userID, id int64, ifMatch []int64) (entity.Phone, error) {
+	var deleted entity.Phone
+	err := p.db.inTx(ctx, func(tx *tracedTx) error {
+		var err error
+		deleted, err = deletePhone(ctx, tx, userID, id, ifMatch)
+		return err
+	})
+
+	return deleted, err
+}
+
+func deletePhone(ctx context.Context, tx *tracedTx, userID, id int64, ifMatch []int64) (entity.Phone, error) {
+	before, err := lockPhone(ctx, tx, id, false, ifMatch)
+	if err != nil {
+		return before, err
+	}
+
+	deleted, err := scanPhone(tx.QueryRowContext(ctx, `UPDATE phones
+		SET deleted_at = now(), deleted_by = $1, version = version + 1
+		WHERE id = $2
+		RETURNING `+phoneColumns, nullableID(userID), id))
+	if err != nil {
+		return deleted, err
+	}
+
+	return deleted, recordRevision(ctx, tx, entity.RevisionDelete, userID, &before, &deleted)
+}
+
+// RestorePhoneById takes the phone out of the trash. It returns
+// sql.ErrNoRows when the phone isn't in the trash.
+func (p *Phones) RestorePhoneById(ctx context.Context, userID, id int64) (entity.Phone, error) {
+	var restored entity.Phone
+	err := p.db.inTx(ctx, func(tx *tracedTx) error {
+		before, err := lockPhone(ctx, tx, id, true, nil)
+		if err != nil {
+			return err
+		}
+
+		restored, err = scanPhone(tx.QueryRowContext(ctx, `UPDATE phones
+			SET deleted_at = NULL, deleted_by = NULL, updated_by = $1, updated_at = now(), version = version + 1
+			WHERE id = $2
+			RETURNING `+phoneColumns, nullableID(userID), id))
+		if err != nil {
+			return err
+		}
+
+		return recordRevision(ctx, tx, entity.RevisionRestore, userID, &before, &restored)
+	})
+
+	return restored, err
+}
+
+// PurgeDeletedPhones permanently deletes the phones moved to the trash
+// before the time.
+func (p *Phones) PurgeDeletedPhones(ctx context.Context, before time.Time) (int64, error) {
+	res, err := p.db.ExecContext(ctx, "DELETE FROM phones WHERE deleted_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// lockPhone reads the phone for a change within tx, live ones or, with
+// deleted, those in the trash. It returns sql.ErrNoRows when there is no
+// such phone and entity.ErrVersionMismatch when ifMatch isn't empty and
+// doesn't hold the phone's version.
+func lockPhone(ctx context.Context, tx *tracedTx, id int64, deleted bool, ifMatch []int64) (entity.Phone, error) {
+	cond := "deleted_at IS NULL"
+	if deleted {
+		cond = "deleted_at IS NOT NULL"
+	}
+
+	ph, err := scanPhone(tx.QueryRowContext(ctx, "SELECT "+phoneColumns+" FROM phones WHERE id = $1 AND "+cond+" FOR UPDATE", id))
+	if err != nil {
+		return ph, err
+	}
+
+	if len(ifMatch) > 0 && !slices.Contains(ifMatch, ph.Version) {
+		return ph, entity.ErrVersionMismatch
+	}
+
+	return ph, nil
 }
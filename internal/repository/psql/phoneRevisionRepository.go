@@ -0,0 +1,122 @@
+package psql
+
+import (
+	"context"
+	"crud-go/internal/entity"
+	"database/sql"
+	"encoding/json"
+)
+
+const phoneRevisionColumns = "phone_id, revision, action, actor_id, created_at, before, after, changes"
+
+// recordRevision stores the change of a phone from before to after; before
+// is nil for a new phone. The revision number is the phone's new version.
+func recordRevision(ctx context.Context, tx *tracedTx, action entity.RevisionAction, userID int64, before, after *entity.Phone) error {
+	values := new(valuesClause)
+	if err := addRevision(values, action, userID, before, after); err != nil {
+		return err
+	}
+
+	return insertRevisions(ctx, tx, values)
+}
+
+func insertRevisions(ctx context.Context, tx *tracedTx, values *valuesClause) error {
+	if len(values.rows) == 0 {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, "INSERT INTO phone_revisions (phone_id, revision, action, actor_id, before, after, changes)"+
+		values.String(), values.args...)
+
+	return err
+}
+
+// addRevision adds the row of a revision like recordRevision's to values.
+func addRevision(values *valuesClause, action entity.RevisionAction, userID int64, before, after *entity.Phone) error {
+	var from, to *entity.PhoneSnapshot
+	if before != nil {
+		s := entity.NewPhoneSnapshot(*before)
+		from = &s
+	}
+	if after != nil {
+		s := entity.NewPhoneSnapshot(*after)
+		to = &s
+	}
+
+	fromJSON, err := nullableJSON(from)
+	if err != nil {
+		return err
+	}
+	toJSON, err := nullableJSON(to)
+	if err != nil {
+		return err
+	}
+	changes, err := json.Marshal(entity.DiffPhoneSnapshots(from, to))
+	if err != nil {
+		return err
+	}
+
+	values.add(after.Id, after.Version, action, nullableID(userID), fromJSON, toJSON, string(changes))
+	return nil
+}
+
+// nullableJSON encodes the snapshot as text: lib/pq would send []byte as
+// bytea, which JSONB columns don't accept.
+func nullableJSON(s *entity.PhoneSnapshot) (sql.NullString, error) {
+	if s == nil {
+		return sql.NullString{}, nil
+	}
+
+	b, err := json.Marshal(s)
+	return sql.NullString{String: string(b), Valid: true}, err
+}
+
+func scanPhoneRevision(row rowScanner) (entity.PhoneRevision, error) {
+	var rev entity.PhoneRevision
+	var before, after, changes []byte
+
+	err := row.Scan(&rev.PhoneID, &rev.Revision, &rev.Action, &rev.ActorID, &rev.CreatedAt, &before, &after, &changes)
+	if err != nil {
+		return rev, err
+	}
+
+	if before != nil {
+		rev.Before = new(entity.PhoneSnapshot)
+		if err := json.Unmarshal(before, rev.Before); err != nil {
+			return rev, err
+		}
+	}
+	if after != nil {
+		rev.After = new(entity.PhoneSnapshot)
+		if err := json.Unmarshal(after, rev.After); err != nil {
+			return rev, err
+		}
+	}
+
+	return rev, json.Unmarshal(changes, &rev.Changes)
+}
+
+// GetPhoneRevisions returns the history of the phone, oldest first.
+func (p *Phones) GetPhoneRevisions(ctx context.Context, phoneID int64) ([]entity.PhoneRevision, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT "+phoneRevisionColumns+" FROM phone_revisions WHERE phone_id = $1 ORDER BY revision", phoneID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := make([]entity.PhoneRevision, 0)
+	for rows.Next() {
+		rev, err := scanPhoneRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (p *Phones) GetPhoneRevision(ctx context.Context, phoneID, revision int64) (entity.PhoneRevision, error) {
+	return scanPhoneRevision(p.db.QueryRowContext(ctx, "SELECT "+phoneRevisionColumns+" FROM phone_revisions WHERE phone_id = $1 AND revision = $2",
+		phoneID, revision))
+}
@@ -0,0 +1,180 @@
+package psql
+
+import (
+	"context"
+	"crud-go/internal/entity"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// fuzzyThreshold is the word similarity a phone needs to be found by the
+// trigram fallback, the default of pg_trgm for similarity. Its default of
+// 0.6 for word similarity misses most typos in short words.
+const fuzzyThreshold = 0.3
+
+// SearchPhones ranks the phones by full-text search. When nothing matches,
+// it falls back to trigram similarity, which tolerates typos.
+func (p *Phones) SearchPhones(ctx context.Context, q entity.PhoneSearchQuery) (entity.PhoneSearchResult, error) {
+	result := entity.PhoneSearchResult{Items: make([]entity.PhoneSearchHit, 0)}
+
+	terms := q.Terms()
+	if len(terms) == 0 {
+		return result, nil
+	}
+
+	// Every word has to match, the last ones as prefixes too so that the
+	// search works while the user is typing. Terms hold only letters and
+	// digits, so they can't break the tsquery syntax.
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = term + ":*"
+	}
+
+	err := searchInto(ctx, p.db, &result, func(word string) bool {
+		for _, term := range terms {
+			if strings.HasPrefix(word, term) {
+				return true
+			}
+		}
+		return false
+	}, "SELECT "+phoneColumns+", ts_rank(search_vector, query) AS rank"+
+		" FROM phones, to_tsquery('simple', $1) AS query"+
+		" WHERE deleted_at IS NULL AND search_vector @@ query"+
+		" ORDER BY rank DESC, id LIMIT $2",
+		strings.Join(prefixes, " & "), q.Limit)
+	if err != nil || len(result.Items) > 0 {
+		return result, err
+	}
+
+	result.Fuzzy = true
+	err = p.db.inTx(ctx, func(tx *tracedTx) error {
+		_, err := tx.ExecContext(ctx, "SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)", fuzzyThreshold)
+		if err != nil {
+			return err
+		}
+
+		return searchInto(ctx, tx, &result, func(word string) bool {
+			for _, term := range terms {
+				if trigramSimilarity(word, term) >= fuzzyThreshold {
+					return true
+				}
+			}
+			return false
+		}, "SELECT "+phoneColumns+", word_similarity($1, search_text) AS rank"+
+			" FROM phones"+
+			" WHERE deleted_at IS NULL AND $1 <% search_text"+
+			" ORDER BY rank DESC, id LIMIT $2",
+			strings.Join(terms, " "), q.Limit)
+	})
+
+	return result, err
+}
+
+func searchInto(ctx context.Context, q querier, result *entity.PhoneSearchResult, match func(word string) bool, query string, args ...any) error {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hit entity.PhoneSearchHit
+		hit.Phone, err = scanPhone(withExtra{rows, []any{&hit.Rank}})
+		if err != nil {
+			return err
+		}
+
+		hit.Highlights = make(map[string]string)
+		for field, value := range map[string]string{
+			"brand":     hit.Phone.Brand,
+			"model":     hit.Phone.Model,
+			"os":        hit.Phone.OS,
+			"processor": hit.Phone.Processor,
+		} {
+			if marked, ok := highlight(value, match); ok {
+				hit.Highlights[field] = marked
+			}
+		}
+
+		result.Items = append(result.Items, hit)
+	}
+
+	return rows.Err()
+}
+
+// withExtra scans the columns selected after the phone ones into extra.
+type withExtra struct {
+	rowScanner
+	extra []any
+}
+
+func (w withExtra) Scan(dest ...any) error {
+	return w.rowScanner.Scan(append(dest, w.extra...)...)
+}
+
+// highlight escapes text as HTML and wraps the words match accepts in
+// <mark> tags. It reports whether any word matched.
+func highlight(text string, match func(word string) bool) (string, bool) {
+	var b strings.Builder
+	matched := false
+
+	rest := text
+	for rest != "" {
+		i := strings.IndexFunc(rest, isWordRune)
+		if i < 0 {
+			i = len(rest)
+		}
+		b.WriteString(html.EscapeString(rest[:i]))
+		rest = rest[i:]
+
+		j := strings.IndexFunc(rest, func(r rune) bool { return !isWordRune(r) })
+		if j < 0 {
+			j = len(rest)
+		}
+		if word := rest[:j]; word != "" {
+			if match(strings.ToLower(word)) {
+				matched = true
+				b.WriteString("<mark>" + html.EscapeString(word) + "</mark>")
+			} else {
+				b.WriteString(html.EscapeString(word))
+			}
+		}
+		rest = rest[j:]
+	}
+
+	return b.String(), matched
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// trigramSimilarity compares two words the way pg_trgm does: the share of
+// trigrams, taken with two spaces in front and one after, that they have in
+// common.
+func trigramSimilarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+
+	common := 0
+	for t := range ta {
+		if tb[t] {
+			common++
+		}
+	}
+
+	return float64(common) / float64(len(ta)+len(tb)-common)
+}
+
+func trigrams(word string) map[string]bool {
+	runes := []rune("  " + word + " ")
+	set := make(map[string]bool, len(runes))
+	for i := 0; i+3 <= len(runes); i++ {
+		set[string(runes[i:i+3])] = true
+	}
+
+	return set
+}
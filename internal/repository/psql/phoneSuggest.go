@@ -0,0 +1,26 @@
+package psql
+
+import (
+	"context"
+	"crud-go/internal/entity"
+)
+
+// EachSuggestValues streams the live phones to fn in one query, with only
+// the id, the version and the suggest fields filled in.
+func (p *Phones) EachSuggestValues(ctx context.Context, fn func(entity.Phone)) error {
+	rows, err := p.db.QueryContext(ctx, "SELECT id, version, brand, model, processor FROM phones WHERE deleted_at IS NULL")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ph entity.Phone
+		if err := rows.Scan(&ph.Id, &ph.Version, &ph.Brand, &ph.Model, &ph.Processor); err != nil {
+			return err
+		}
+		fn(ph)
+	}
+
+	return rows.Err()
+}
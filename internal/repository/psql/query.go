@@ -0,0 +1,98 @@
+package psql
+
+import (
+	"strconv"
+	"strings"
+)
+
+// whereClause collects AND-ed conditions written with "?" placeholders and
+// numbers them as $1, $2, ... in the order they were added.
+type whereClause struct {
+	conds []string
+	args  []any
+}
+
+func (w *whereClause) add(cond string, args ...any) {
+	var b strings.Builder
+	for _, part := range strings.SplitAfter(cond, "?") {
+		if strings.HasSuffix(part, "?") {
+			w.args = append(w.args, args[0])
+			args = args[1:]
+			part = strings.TrimSuffix(part, "?") + "$" + strconv.Itoa(len(w.args))
+		}
+		b.WriteString(part)
+	}
+
+	w.conds = append(w.conds, b.String())
+}
+
+func (w *whereClause) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+
+	return " WHERE " + strings.Join(w.conds, " AND ")
+}
+
+// setClause collects the assignments of an UPDATE, numbered as $1, $2, ...
+type setClause struct {
+	assignments []string
+	args        []any
+}
+
+func (s *setClause) add(column string, value any) {
+	s.args = append(s.args, value)
+	s.assignments = append(s.assignments, column+" = $"+strconv.Itoa(len(s.args)))
+}
+
+// addExpr adds an assignment without arguments, like "updated_at = now()".
+func (s *setClause) addExpr(assignment string) {
+	s.assignments = append(s.assignments, assignment)
+}
+
+// arg adds a value that isn't assigned, e.g. for the WHERE clause, and
+// returns its placeholder.
+func (s *setClause) arg(value any) string {
+	s.args = append(s.args, value)
+	return "$" + strconv.Itoa(len(s.args))
+}
+
+func (s *setClause) String() string {
+	return " SET " + strings.Join(s.assignments, ", ")
+}
+
+// valuesClause collects the rows of a multi-row INSERT, numbered as $1, $2,
+// ...
+type valuesClause struct {
+	rows []string
+	args []any
+}
+
+func (v *valuesClause) add(values ...any) {
+	placeholders := make([]string, len(values))
+	for i, value := range values {
+		v.args = append(v.args, value)
+		placeholders[i] = "$" + strconv.Itoa(len(v.args))
+	}
+
+	v.rows = append(v.rows, "("+strings.Join(placeholders, ", ")+")")
+}
+
+func (v *valuesClause) String() string {
+	return " VALUES " + v.list()
+}
+
+// list is the rows alone, e.g. for "(a, b) IN (...)".
+func (v *valuesClause) list() string {
+	return strings.Join(v.rows, ", ")
+}
+
+// nullableID makes the id of a user NULL when there is none, as for
+// changes made from the command line.
+func nullableID(id int64) *int64 {
+	if id == 0 {
+		return nil
+	}
+
+	return &id
+}
@@ -0,0 +1,52 @@
+package psql
+
+import (
+	"context"
+	"crud-go/internal/entity"
+	"database/sql"
+)
+
+type RefreshTokens struct {
+	db *tracedDB
+}
+
+func NewRefreshToken(db *sql.DB) *RefreshTokens {
+	return &RefreshTokens{db: traced(db)}
+}
+
+func (r *RefreshTokens) Create(ctx context.Context, token entity.RefreshToken) error {
+	_, err := r.db.ExecContext(ctx, "INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at) VALUES ($1, $2, $3, $4)",
+		token.UserID, token.TokenHash, token.FamilyID, token.ExpiresAt)
+
+	return err
+}
+
+func (r *RefreshTokens) GetByHash(ctx context.Context, hash string) (entity.RefreshToken, error) {
+	var t entity.RefreshToken
+	err := r.db.QueryRowContext(ctx, "SELECT id, user_id, token_hash, family_id, expires_at, used_at, revoked_at, created_at FROM refresh_tokens WHERE token_hash = $1", hash).
+		Scan(&t.ID, &t.UserID, &t.TokenHash, &t.FamilyID, &t.ExpiresAt, &t.UsedAt, &t.RevokedAt, &t.CreatedAt)
+
+	return t, err
+}
+
+// MarkUsed flags the token as rotated. It reports false when the token had
+// already been used, which happens when two requests race with one token.
+func (r *RefreshTokens) MarkUsed(ctx context.Context, id int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, "UPDATE refresh_tokens SET used_at = now() WHERE id = $1 AND used_at IS NULL", id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *RefreshTokens) RevokeFamily(ctx context.Context, familyID string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = now() WHERE family_id = $1 AND revoked_at IS NULL", familyID)
+	return err
+}
+
+func (r *RefreshTokens) RevokeUser(ctx context.Context, userID int64) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL", userID)
+	return err
+}
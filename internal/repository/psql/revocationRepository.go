@@ -0,0 +1,63 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type Revocations struct {
+	db *tracedDB
+}
+
+func NewRevocation(db *sql.DB) *Revocations {
+	return &Revocations{db: traced(db)}
+}
+
+func (r *Revocations) RevokeToken(ctx context.Context, tokenID string, userID int64, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, "INSERT INTO revoked_tokens (jti, user_id, expires_at) VALUES ($1, $2, $3) ON CONFLICT (jti) DO NOTHING",
+		tokenID, userID, expiresAt)
+
+	return err
+}
+
+func (r *Revocations) RevokeUserTokens(ctx context.Context, userID int64, before, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO revoked_user_tokens (user_id, revoked_before, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET
+			revoked_before = GREATEST(revoked_user_tokens.revoked_before, EXCLUDED.revoked_before),
+			expires_at = GREATEST(revoked_user_tokens.expires_at, EXCLUDED.expires_at)`,
+		userID, before, expiresAt)
+
+	return err
+}
+
+func (r *Revocations) IsRevoked(ctx context.Context, tokenID string, userID int64, issuedAt time.Time) (bool, error) {
+	var revoked bool
+	err := r.db.QueryRowContext(ctx, `SELECT
+		EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1 AND expires_at > now()) OR
+		EXISTS (SELECT 1 FROM revoked_user_tokens WHERE user_id = $2 AND revoked_before >= $3 AND expires_at > now())`,
+		tokenID, userID, issuedAt).Scan(&revoked)
+
+	return revoked, err
+}
+
+func (r *Revocations) PurgeExpired(ctx context.Context, now time.Time) (int64, error) {
+	var purged int64
+	for _, query := range []string{
+		"DELETE FROM revoked_tokens WHERE expires_at <= $1",
+		"DELETE FROM revoked_user_tokens WHERE expires_at <= $1",
+	} {
+		res, err := r.db.ExecContext(ctx, query, now)
+		if err != nil {
+			return purged, err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return purged, err
+		}
+		purged += n
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,152 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("crud-go/internal/repository/psql")
+
+// querier is what *sql.DB and *sql.Tx have in common.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// tracedDB starts a span for every statement the repositories run. It
+// embeds *sql.DB, so repositories use it exactly like the pool.
+type tracedDB struct {
+	*sql.DB
+}
+
+func traced(db *sql.DB) *tracedDB {
+	return &tracedDB{DB: db}
+}
+
+func (db *tracedDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return execTraced(ctx, db.DB, query, args...)
+}
+
+func (db *tracedDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return queryTraced(ctx, db.DB, query, args...)
+}
+
+func (db *tracedDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return queryRowTraced(ctx, db.DB, query, args...)
+}
+
+func (db *tracedDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*tracedTx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tracedTx{Tx: tx}, nil
+}
+
+// inTx runs fn in a transaction that is committed when fn succeeds.
+func (db *tracedDB) inTx(ctx context.Context, fn func(tx *tracedTx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// tracedTx is tracedDB for a transaction.
+type tracedTx struct {
+	*sql.Tx
+}
+
+// inSavepoint runs fn so that its failure only undoes what fn did and
+// leaves the transaction usable. fnErr is fn's error, err that of the
+// savepoint itself.
+func (tx *tracedTx) inSavepoint(ctx context.Context, fn func() error) (fnErr, err error) {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT write"); err != nil {
+		return nil, err
+	}
+
+	if fnErr = fn(); fnErr != nil {
+		if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT write"); err != nil {
+			return fnErr, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT write")
+	return fnErr, err
+}
+
+func (tx *tracedTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return execTraced(ctx, tx.Tx, query, args...)
+}
+
+func (tx *tracedTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return queryTraced(ctx, tx.Tx, query, args...)
+}
+
+func (tx *tracedTx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return queryRowTraced(ctx, tx.Tx, query, args...)
+}
+
+func execTraced(ctx context.Context, q querier, query string, args ...any) (sql.Result, error) {
+	ctx, span := startSpan(ctx, "exec", query)
+	defer span.End()
+
+	res, err := q.ExecContext(ctx, query, args...)
+	recordError(span, err)
+
+	return res, err
+}
+
+func queryTraced(ctx context.Context, q querier, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := startSpan(ctx, "query", query)
+	defer span.End()
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	recordError(span, err)
+
+	return rows, err
+}
+
+func queryRowTraced(ctx context.Context, q querier, query string, args ...any) *sql.Row {
+	ctx, span := startSpan(ctx, "query", query)
+	defer span.End()
+
+	row := q.QueryRowContext(ctx, query, args...)
+	recordError(span, row.Err())
+
+	return row
+}
+
+func startSpan(ctx context.Context, operation, query string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "sql."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.statement", query),
+		))
+}
+
+// recordError marks the span as failed. A missing row is an answer, not a
+// failure.
+func recordError(span trace.Span, err error) {
+	if err == nil || errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -7,24 +7,48 @@ import (
 )
 
 type Users struct {
-	db *sql.DB
+	db *tracedDB
 }
 
 func NewUser(db *sql.DB) *Users {
-	return &Users{db: db}
+	return &Users{db: traced(db)}
 }
 
 func (u *Users) Create(ctx context.Context, user entity.User) error {
-	_, err := u.db.Exec("INSERT INTO users (name, email, password, registered_at) values ($1, $2, $3, $4)",
+	_, err := u.db.ExecContext(ctx, "INSERT INTO users (name, email, password, registered_at) values ($1, $2, $3, $4)",
 		user.Name, user.Email, user.Password, user.RegisteredAt)
 
-	return err
+	return mapError(err)
+}
+
+func (u *Users) GetByEmail(ctx context.Context, email string) (entity.User, error) {
+	var user entity.User
+	err := u.db.QueryRowContext(ctx, "SELECT id, name, email, password, role, registered_at FROM users WHERE email=$1", email).
+		Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Role, &user.RegisteredAt)
+
+	return user, err
 }
 
-func (u *Users) GetByCredentials(ctx context.Context, email, password string) (entity.User, error) {
+func (u *Users) GetById(ctx context.Context, id int64) (entity.User, error) {
 	var user entity.User
-	err := u.db.QueryRow("SELECT id, name, email, registered_at FROM users WHERE email=$1 AND password=$2", email, password).
-		Scan(&user.ID, &user.Name, &user.Email, &user.RegisteredAt)
+	err := u.db.QueryRowContext(ctx, "SELECT id, name, email, password, role, registered_at FROM users WHERE id=$1", id).
+		Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Role, &user.RegisteredAt)
 
 	return user, err
 }
+
+// UpdateRole reports false when there is no user with the id.
+func (u *Users) UpdateRole(ctx context.Context, id int64, role entity.Role) (bool, error) {
+	res, err := u.db.ExecContext(ctx, "UPDATE users SET role=$1 WHERE id=$2", role, id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (u *Users) UpdatePassword(ctx context.Context, id int64, password string) error {
+	_, err := u.db.ExecContext(ctx, "UPDATE users SET password=$1 WHERE id=$2", password, id)
+	return err
+}
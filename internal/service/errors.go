@@ -0,0 +1,90 @@
+package service
+
+import (
+	"crud-go/internal/entity"
+	"errors"
+	"fmt"
+)
+
+type ErrorKind string
+
+const (
+	KindNotFound     ErrorKind = "not-found"
+	KindConflict     ErrorKind = "conflict"
+	KindValidation   ErrorKind = "validation"
+	KindUnauthorized ErrorKind = "unauthorized"
+	KindForbidden    ErrorKind = "forbidden"
+	// KindPreconditionFailed means the record changed since the caller read
+	// it.
+	KindPreconditionFailed ErrorKind = "precondition-failed"
+	// KindPreconditionRequired means the caller has to name the version it
+	// read for the change to go through.
+	KindPreconditionRequired ErrorKind = "precondition-required"
+)
+
+// Error is a failure the caller can act upon, as opposed to an internal
+// error such as a lost database connection. Transports map the kind to
+// their own status codes.
+type Error struct {
+	Kind   ErrorKind
+	Detail string
+	Fields []entity.FieldError
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Detail + ": " + e.Err.Error()
+	}
+
+	return e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func newError(kind ErrorKind, format string, args ...any) *Error {
+	return &Error{Kind: kind, Detail: fmt.Sprintf(format, args...)}
+}
+
+func NotFound(format string, args ...any) *Error {
+	return newError(KindNotFound, format, args...)
+}
+
+func Conflict(format string, args ...any) *Error {
+	return newError(KindConflict, format, args...)
+}
+
+func Unauthorized(format string, args ...any) *Error {
+	return newError(KindUnauthorized, format, args...)
+}
+
+func Forbidden(format string, args ...any) *Error {
+	return newError(KindForbidden, format, args...)
+}
+
+func PreconditionFailed(format string, args ...any) *Error {
+	return newError(KindPreconditionFailed, format, args...)
+}
+
+// Invalid wraps the error returned by a Validate method, keeping the
+// failing fields.
+func Invalid(err error) *Error {
+	return &Error{
+		Kind:   KindValidation,
+		Detail: "validation failed",
+		Fields: entity.FieldErrors(err),
+		Err:    err,
+	}
+}
+
+// ErrorKindOf returns the kind of err, or "" for internal errors.
+func ErrorKindOf(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+
+	return ""
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"crud-go/internal/entity"
+	"errors"
+	"io"
+)
+
+// ImportPhones upserts the phones read from rows by natural key, a batch
+// at a time, so that files of any size can be imported. Rows that can't be
+// read or fail validation are reported and skipped. When the file can't be
+// read any further, the rows read so far are imported and the error comes
+// with their report.
+//
+// With dryRun nothing is written. The dry run remembers what every row
+// would leave behind its key, so later rows with the key are reported as
+// the real run would report them.
+func (p *Phones) ImportPhones(ctx context.Context, actor entity.Actor, rows entity.PhoneRowReader, dryRun bool) (entity.PhoneImportReport, error) {
+	ctx, span := tracer.Start(ctx, "Phones.ImportPhones")
+	defer span.End()
+
+	report := entity.PhoneImportReport{DryRun: dryRun, Errors: make([]entity.ImportRowError, 0)}
+
+	batch := make([]entity.PhoneInputDto, 0, p.importBatch)
+	keys := make(map[string]bool, p.importBatch)
+	written := make(map[string]entity.PhoneInputDto)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		upserts, err := p.repository.UpsertPhones(ctx, actor.UserID, p.importKey, batch, dryRun)
+		if err != nil {
+			return err
+		}
+
+		for _, u := range upserts {
+			switch u.Outcome {
+			case entity.UpsertCreated:
+				report.Created++
+			case entity.UpsertUpdated:
+				report.Updated++
+			case entity.UpsertUnchanged:
+				report.Unchanged++
+			}
+			if !dryRun {
+				p.suggest.put(u.Phone)
+			}
+		}
+
+		batch = batch[:0]
+		clear(keys)
+		return nil
+	}
+
+	for {
+		row, err := rows.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if err := flush(); err != nil {
+				return report, err
+			}
+			return report, newError(KindValidation, "the file can't be read any further, the report covers the rows before: %v", err)
+		}
+
+		report.Rows++
+		if row.Err == nil {
+			row.Err = row.Phone.Validate()
+		}
+		if row.Err != nil {
+			report.AddError(row.Line, row.Err)
+			continue
+		}
+
+		// A batch can't upsert the same phone twice, so a repeated key
+		// starts a new one.
+		key := entity.PhoneNaturalKey(p.importKey, row.Phone)
+		if dryRun {
+			prev, ok := written[key]
+			written[key] = row.Phone
+			if ok {
+				if prev == row.Phone {
+					report.Unchanged++
+				} else {
+					report.Updated++
+				}
+				continue
+			}
+		}
+		if keys[key] {
+			if err := flush(); err != nil {
+				return report, err
+			}
+		}
+
+		batch = append(batch, row.Phone)
+		keys[key] = true
+		if len(batch) == p.importBatch {
+			if err := flush(); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	return report, flush()
+}
@@ -3,42 +3,584 @@ package service
 import (
 	"context"
 	"crud-go/internal/entity"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
 )
 
 type PhonesRepository interface {
 	GetPhoneById(ctx context.Context, id int64) (entity.Phone, error)
-	GetAllPhones(ctx context.Context) ([]entity.Phone, error)
-	CreatePhone(ctx context.Context, ph entity.PhoneInputDto) error
-	UpdatePhoneById(ctx context.Context, id int64, ph entity.PhoneInputDto) error
-	DeletePhoneById(ctx context.Context, id int64) error
+	GetPhonesByIds(ctx context.Context, ids []int64) ([]entity.Phone, error)
+	GetAllPhones(ctx context.Context, q entity.PhoneQuery) (entity.PhonePage, error)
+	CreatePhone(ctx context.Context, userID int64, ph entity.PhoneInputDto) (entity.Phone, error)
+	UpdatePhoneById(ctx context.Context, userID, id int64, ifMatch []int64, ph entity.PhoneInputDto) (entity.Phone, error)
+	PatchPhoneById(ctx context.Context, userID, id int64, ifMatch []int64, patch entity.PhonePatch) (entity.Phone, error)
+	DeletePhoneById(ctx context.Context, userID, id int64, ifMatch []int64) (entity.Phone, error)
+	RestorePhoneById(ctx context.Context, userID, id int64) (entity.Phone, error)
+	PurgeDeletedPhones(ctx context.Context, before time.Time) (int64, error)
+	GetPhoneRevisions(ctx context.Context, phoneID int64) ([]entity.PhoneRevision, error)
+	GetPhoneRevision(ctx context.Context, phoneID, revision int64) (entity.PhoneRevision, error)
+	SearchPhones(ctx context.Context, q entity.PhoneSearchQuery) (entity.PhoneSearchResult, error)
+	GetPhoneFacets(ctx context.Context, q entity.PhoneFacetQuery) (entity.PhoneFacets, error)
+	BulkWritePhones(ctx context.Context, userID int64, ops []entity.PhoneBulkOp, atomic bool) ([]entity.PhoneBulkResult, error)
+	UpsertPhones(ctx context.Context, userID int64, key []string, phs []entity.PhoneInputDto, dryRun bool) ([]entity.PhoneUpsert, error)
+	EachSuggestValues(ctx context.Context, fn func(entity.Phone)) error
 }
 
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+
+	MaxSearchLength = 256
+
+	DefaultYearInterval = 1
+	MaxYearInterval     = 100
+
+	DefaultSuggestions = 10
+	MaxSuggestions     = 50
+
+	MaxBulkOps = 10000
+)
+
+var ErrNotOwner = Forbidden("only the creator of the phone or an administrator can change it")
+
 type Phones struct {
 	repository PhonesRepository
+
+	// enforceOwnership restricts changes of a phone to its creator and
+	// administrators.
+	enforceOwnership bool
+
+	// suggest serves the typeahead of the phone fields. Every write below
+	// keeps it current.
+	suggest *suggestIndex
+
+	// importKey are the fields by which an imported row finds the phone it
+	// updates, importBatch the number of rows upserted at once.
+	importKey   []string
+	importBatch int
 }
 
-func NewPhones(repository PhonesRepository) *Phones {
+func NewPhones(repository PhonesRepository, enforceOwnership bool, importKey []string, importBatch int) *Phones {
 	return &Phones{
-		repository: repository,
+		repository:       repository,
+		enforceOwnership: enforceOwnership,
+		suggest:          newSuggestIndex(),
+		importKey:        importKey,
+		importBatch:      importBatch,
 	}
 }
 
 func (p *Phones) GetPhoneById(ctx context.Context, id int64) (entity.Phone, error) {
-	return p.repository.GetPhoneById(ctx, id)
+	ctx, span := tracer.Start(ctx, "Phones.GetPhoneById")
+	defer span.End()
+
+	ph, err := p.repository.GetPhoneById(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ph, NotFound("phone %d not found", id)
+	}
+
+	return ph, err
+}
+
+func (p *Phones) GetAllPhones(ctx context.Context, q entity.PhoneQuery) (entity.PhonePage, error) {
+	ctx, span := tracer.Start(ctx, "Phones.GetAllPhones")
+	defer span.End()
+
+	if q.Limit <= 0 {
+		q.Limit = DefaultPageSize
+	}
+	if q.Limit > MaxPageSize {
+		q.Limit = MaxPageSize
+	}
+	if q.Sort.Field == "" {
+		q.Sort.Field = "id"
+	}
+
+	return p.repository.GetAllPhones(ctx, q)
+}
+
+func (p *Phones) CreatePhone(ctx context.Context, actor entity.Actor, ph entity.PhoneInputDto) (entity.Phone, error) {
+	ctx, span := tracer.Start(ctx, "Phones.CreatePhone")
+	defer span.End()
+
+	if err := ph.Validate(); err != nil {
+		return entity.Phone{}, Invalid(err)
+	}
+
+	created, err := p.repository.CreatePhone(ctx, actor.UserID, ph)
+	if err == nil {
+		p.suggest.put(created)
+	}
+
+	return created, err
+}
+
+// UpdatePhoneById overwrites the phone. When ifMatch isn't empty the phone
+// must still be at one of these versions.
+func (p *Phones) UpdatePhoneById(ctx context.Context, actor entity.Actor, id int64, ifMatch []int64, ph entity.PhoneInputDto) (entity.Phone, error) {
+	ctx, span := tracer.Start(ctx, "Phones.UpdatePhoneById")
+	defer span.End()
+
+	if err := ph.Validate(); err != nil {
+		return entity.Phone{}, Invalid(err)
+	}
+
+	if err := p.checkOwner(ctx, actor, id); err != nil {
+		return entity.Phone{}, err
+	}
+
+	updated, err := p.repository.UpdatePhoneById(ctx, actor.UserID, id, ifMatch, ph)
+	if err != nil {
+		return updated, phoneWriteError(err, id)
+	}
+
+	p.suggest.put(updated)
+	return updated, nil
+}
+
+// patchAttempts bounds how often a patch without If-Match is reapplied to
+// a phone that keeps changing under it.
+const patchAttempts = 3
+
+// PatchPhoneById changes only the fields in the patch. The phone the patch
+// results in must be valid as a whole. The patch, its test operations
+// included, is checked against the version it is written to: without
+// ifMatch, a phone changed in the meantime gets the patch checked and
+// applied again.
+func (p *Phones) PatchPhoneById(ctx context.Context, actor entity.Actor, id int64, ifMatch []int64, patch entity.PhonePatch) (entity.Phone, error) {
+	ctx, span := tracer.Start(ctx, "Phones.PatchPhoneById")
+	defer span.End()
+
+	for attempt := 1; ; attempt++ {
+		current, err := p.GetPhoneById(ctx, id)
+		if err != nil {
+			return current, err
+		}
+
+		if err := p.checkOwnerOf(actor, current); err != nil {
+			return current, err
+		}
+
+		if len(ifMatch) > 0 && !slices.Contains(ifMatch, current.Version) {
+			return current, phoneWriteError(entity.ErrVersionMismatch, id)
+		}
+
+		merged, err := patch.Apply(current)
+		if errors.Is(err, entity.ErrPatchTestFailed) {
+			return current, &Error{Kind: KindConflict, Detail: "the phone doesn't match the patch", Err: err}
+		}
+		if err != nil {
+			return current, err
+		}
+
+		if err := merged.Validate(); err != nil {
+			return current, Invalid(err)
+		}
+
+		if patch.Empty() {
+			return current, nil
+		}
+
+		updated, err := p.repository.PatchPhoneById(ctx, actor.UserID, id, []int64{current.Version}, patch)
+		if errors.Is(err, entity.ErrVersionMismatch) && len(ifMatch) == 0 {
+			if attempt < patchAttempts {
+				continue
+			}
+			return current, Conflict("phone %d keeps changing, try the patch again", id)
+		}
+		if err != nil {
+			return updated, phoneWriteError(err, id)
+		}
+
+		p.suggest.put(updated)
+		return updated, nil
+	}
 }
 
-func (p *Phones) GetAllPhones(ctx context.Context) ([]entity.Phone, error) {
-	return p.repository.GetAllPhones(ctx)
+// DeletePhoneById moves the phone to the trash, from where administrators
+// can restore it until it is purged. ifMatch works as for UpdatePhoneById.
+func (p *Phones) DeletePhoneById(ctx context.Context, actor entity.Actor, id int64, ifMatch []int64) error {
+	ctx, span := tracer.Start(ctx, "Phones.DeletePhoneById")
+	defer span.End()
+
+	if err := p.checkOwner(ctx, actor, id); err != nil {
+		return err
+	}
+
+	deleted, err := p.repository.DeletePhoneById(ctx, actor.UserID, id, ifMatch)
+	if err != nil {
+		return phoneWriteError(err, id)
+	}
+
+	p.suggest.remove(deleted.Id, deleted.Version, deletedAt(deleted))
+	return nil
 }
 
-func (p *Phones) CreatePhone(ctx context.Context, ph entity.PhoneInputDto) error {
-	return p.repository.CreatePhone(ctx, ph)
+// BulkWritePhones runs the operations in order. When atomic, either all of
+// them succeed or nothing is written and the error tells which one failed.
+// Otherwise every operation that can succeeds and the failures are in the
+// results. requireVersion makes updates and deletes without a version fail,
+// as changes without If-Match do.
+func (p *Phones) BulkWritePhones(ctx context.Context, actor entity.Actor, ops []entity.PhoneBulkOp, atomic, requireVersion bool) ([]entity.PhoneBulkResult, error) {
+	ctx, span := tracer.Start(ctx, "Phones.BulkWritePhones")
+	defer span.End()
+
+	if len(ops) == 0 {
+		return nil, newError(KindValidation, "no operations")
+	}
+	if len(ops) > MaxBulkOps {
+		return nil, newError(KindValidation, "no more than %d operations at once", MaxBulkOps)
+	}
+
+	targets, err := p.bulkTargets(ctx, ops)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]entity.PhoneBulkResult, len(ops))
+	valid := make([]entity.PhoneBulkOp, 0, len(ops))
+	positions := make([]int, 0, len(ops))
+	checked := make(map[int64]bool)
+	for i, op := range ops {
+		results[i] = entity.PhoneBulkResult{Index: i, Action: op.Action, ID: op.ID}
+		if err := p.checkBulkOp(actor, op, requireVersion, targets, checked); err != nil {
+			if atomic {
+				return nil, bulkOpError(i, err)
+			}
+			results[i].Err = err
+			continue
+		}
+
+		valid = append(valid, op)
+		positions = append(positions, i)
+	}
+
+	if len(valid) == 0 {
+		return results, nil
+	}
+
+	written, err := p.repository.BulkWritePhones(ctx, actor.UserID, valid, atomic)
+	var opErr *entity.BulkOpError
+	if errors.As(err, &opErr) {
+		return nil, bulkOpError(positions[opErr.Index], phoneWriteError(opErr.Err, valid[opErr.Index].ID))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for k, res := range written {
+		res.Index = positions[k]
+		res.Err = phoneWriteError(res.Err, res.ID)
+		results[res.Index] = res
+
+		switch {
+		case res.Err != nil:
+		case res.Action == entity.BulkDelete:
+			p.suggest.remove(res.Phone.Id, res.Phone.Version, deletedAt(*res.Phone))
+		default:
+			p.suggest.put(*res.Phone)
+		}
+	}
+
+	return results, nil
 }
 
-func (p *Phones) UpdatePhoneById(ctx context.Context, id int64, ph entity.PhoneInputDto) error {
-	return p.repository.UpdatePhoneById(ctx, id, ph)
+// bulkTargets reads the live phones the updates and deletes of ops change,
+// in one query, by id.
+func (p *Phones) bulkTargets(ctx context.Context, ops []entity.PhoneBulkOp) (map[int64]entity.Phone, error) {
+	var ids []int64
+	for _, op := range ops {
+		if op.Action != entity.BulkCreate && op.ID > 0 {
+			ids = append(ids, op.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	phones, err := p.repository.GetPhonesByIds(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make(map[int64]entity.Phone, len(phones))
+	for _, ph := range phones {
+		targets[int64(ph.Id)] = ph
+	}
+
+	return targets, nil
 }
 
-func (p *Phones) DeletePhoneById(ctx context.Context, id int64) error {
-	return p.repository.DeletePhoneById(ctx, id)
+// checkBulkOp checks what the single writes check before they touch the
+// repository, against the phones read by bulkTargets. The version of the
+// first operation on a phone is checked here too; later ones can only be
+// checked as they are written. checked records the phones already seen.
+func (p *Phones) checkBulkOp(actor entity.Actor, op entity.PhoneBulkOp, requireVersion bool, targets map[int64]entity.Phone, checked map[int64]bool) error {
+	switch op.Action {
+	case entity.BulkCreate, entity.BulkUpdate, entity.BulkDelete:
+	default:
+		return newError(KindValidation, "unknown action %q, use create, update or delete", op.Action)
+	}
+
+	if op.Action != entity.BulkCreate && op.ID <= 0 {
+		return newError(KindValidation, "%s needs the id of the phone", op.Action)
+	}
+
+	if op.Action != entity.BulkCreate && requireVersion && op.Version == 0 {
+		return newError(KindPreconditionRequired, "%s needs the version of the phone it changes", op.Action)
+	}
+
+	if op.Action != entity.BulkDelete {
+		if op.Phone == nil {
+			return newError(KindValidation, "%s needs the phone", op.Action)
+		}
+		if err := op.Phone.Validate(); err != nil {
+			return Invalid(err)
+		}
+	}
+
+	if op.Action == entity.BulkCreate {
+		return nil
+	}
+
+	ph, ok := targets[op.ID]
+	if !ok {
+		return NotFound("phone %d not found", op.ID)
+	}
+	if err := p.checkOwnerOf(actor, ph); err != nil {
+		return err
+	}
+	if !checked[op.ID] && op.Version != 0 && op.Version != ph.Version {
+		return phoneWriteError(entity.ErrVersionMismatch, op.ID)
+	}
+
+	checked[op.ID] = true
+	return nil
+}
+
+// bulkOpError tells which operation made an atomic bulk write fail.
+func bulkOpError(index int, err error) error {
+	var e *Error
+	if !errors.As(err, &e) {
+		return &entity.BulkOpError{Index: index, Err: err}
+	}
+
+	return &Error{
+		Kind:   e.Kind,
+		Detail: fmt.Sprintf("operation %d: %s; nothing was written", index, e.Detail),
+		Fields: e.Fields,
+		Err:    e.Err,
+	}
+}
+
+// SearchPhones finds the live phones matching the words of the query, best
+// matches first.
+func (p *Phones) SearchPhones(ctx context.Context, q entity.PhoneSearchQuery) (entity.PhoneSearchResult, error) {
+	ctx, span := tracer.Start(ctx, "Phones.SearchPhones")
+	defer span.End()
+
+	if len(q.Terms()) == 0 {
+		return entity.PhoneSearchResult{}, newError(KindValidation, "the search needs at least one word")
+	}
+	if len(q.Text) > MaxSearchLength {
+		return entity.PhoneSearchResult{}, newError(KindValidation, "the search can't be longer than %d bytes", MaxSearchLength)
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = DefaultPageSize
+	}
+	if q.Limit > MaxPageSize {
+		q.Limit = MaxPageSize
+	}
+
+	return p.repository.SearchPhones(ctx, q)
+}
+
+// GetPhoneFacets counts the live phones matching the filter by each of the
+// fields, all of them when none is given.
+func (p *Phones) GetPhoneFacets(ctx context.Context, q entity.PhoneFacetQuery) (entity.PhoneFacets, error) {
+	ctx, span := tracer.Start(ctx, "Phones.GetPhoneFacets")
+	defer span.End()
+
+	if len(q.Fields) == 0 {
+		q.Fields = slices.Clone(entity.PhoneFacetFields)
+	}
+	if q.YearInterval <= 0 {
+		q.YearInterval = DefaultYearInterval
+	}
+	if q.YearInterval > MaxYearInterval {
+		return entity.PhoneFacets{}, newError(KindValidation, "the year interval can't be longer than %d years", MaxYearInterval)
+	}
+
+	return p.repository.GetPhoneFacets(ctx, q)
+}
+
+// SuggestPhoneValues returns the values of the field starting with prefix,
+// ignoring case, that the most live phones have.
+func (p *Phones) SuggestPhoneValues(ctx context.Context, field, prefix string, limit int) ([]entity.Suggestion, error) {
+	_, span := tracer.Start(ctx, "Phones.SuggestPhoneValues")
+	defer span.End()
+
+	if !slices.Contains(entity.SuggestFields, field) {
+		return nil, newError(KindValidation, "no suggestions for field %q, only for %s", field, strings.Join(entity.SuggestFields, ", "))
+	}
+
+	if limit <= 0 {
+		limit = DefaultSuggestions
+	}
+	if limit > MaxSuggestions {
+		limit = MaxSuggestions
+	}
+
+	return p.suggest.suggest(field, prefix, limit), nil
+}
+
+// RebuildSuggestIndex loads the values of all the live phones into the
+// index of SuggestPhoneValues.
+func (p *Phones) RebuildSuggestIndex(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "Phones.RebuildSuggestIndex")
+	defer span.End()
+
+	fresh := newSuggestIndex()
+	if err := p.repository.EachSuggestValues(ctx, fresh.put); err != nil {
+		return err
+	}
+
+	p.suggest.reset(fresh)
+	return nil
+}
+
+// GetDeletedPhones lists the trash the same way GetAllPhones lists the live
+// phones.
+func (p *Phones) GetDeletedPhones(ctx context.Context, q entity.PhoneQuery) (entity.PhonePage, error) {
+	ctx, span := tracer.Start(ctx, "Phones.GetDeletedPhones")
+	defer span.End()
+
+	q.Deleted = true
+	return p.GetAllPhones(ctx, q)
+}
+
+func (p *Phones) RestorePhoneById(ctx context.Context, actor entity.Actor, id int64) (entity.Phone, error) {
+	ctx, span := tracer.Start(ctx, "Phones.RestorePhoneById")
+	defer span.End()
+
+	ph, err := p.repository.RestorePhoneById(ctx, actor.UserID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ph, NotFound("phone %d is not in the trash", id)
+	}
+	if err == nil {
+		p.suggest.put(ph)
+	}
+
+	return ph, err
+}
+
+// PurgeDeletedPhones permanently deletes the phones that have been in the
+// trash for longer than retention.
+func (p *Phones) PurgeDeletedPhones(ctx context.Context, retention time.Duration) (int64, error) {
+	before := time.Now().Add(-retention)
+	n, err := p.repository.PurgeDeletedPhones(ctx, before)
+	if err != nil {
+		return n, err
+	}
+
+	p.suggest.purge(before)
+	return n, nil
+}
+
+// deletedAt is when the phone went to the trash, or now for a phone read
+// without it.
+func deletedAt(ph entity.Phone) time.Time {
+	if ph.DeletedAt == nil {
+		return time.Now()
+	}
+
+	return *ph.DeletedAt
+}
+
+// GetPhoneHistory returns every recorded change of the phone, oldest first.
+// Phones created before history was kept may have an empty history.
+func (p *Phones) GetPhoneHistory(ctx context.Context, id int64) ([]entity.PhoneRevision, error) {
+	ctx, span := tracer.Start(ctx, "Phones.GetPhoneHistory")
+	defer span.End()
+
+	revisions, err := p.repository.GetPhoneRevisions(ctx, id)
+	if err != nil || len(revisions) > 0 {
+		return revisions, err
+	}
+
+	if _, err := p.GetPhoneById(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+func (p *Phones) GetPhoneRevision(ctx context.Context, id, revision int64) (entity.PhoneRevision, error) {
+	ctx, span := tracer.Start(ctx, "Phones.GetPhoneRevision")
+	defer span.End()
+
+	rev, err := p.repository.GetPhoneRevision(ctx, id, revision)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rev, NotFound("phone %d has no revision %d", id, revision)
+	}
+
+	return rev, err
+}
+
+// RevertPhoneById brings the phone back to the state it had at the
+// revision. It is an ordinary update, so it is checked and recorded like
+// any other.
+func (p *Phones) RevertPhoneById(ctx context.Context, actor entity.Actor, id, revision int64, ifMatch []int64) (entity.Phone, error) {
+	ctx, span := tracer.Start(ctx, "Phones.RevertPhoneById")
+	defer span.End()
+
+	rev, err := p.GetPhoneRevision(ctx, id, revision)
+	if err != nil {
+		return entity.Phone{}, err
+	}
+
+	return p.UpdatePhoneById(ctx, actor, id, ifMatch, rev.After.Input())
+}
+
+// phoneWriteError turns the repository errors of a write to the phone into
+// errors the caller can act upon.
+func phoneWriteError(err error, id int64) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return NotFound("phone %d not found", id)
+	case errors.Is(err, entity.ErrVersionMismatch):
+		return PreconditionFailed("phone %d was changed by someone else, fetch it again", id)
+	}
+
+	return err
+}
+
+func (p *Phones) checkOwner(ctx context.Context, actor entity.Actor, id int64) error {
+	if !p.enforceOwnership || actor.IsAdmin() {
+		return nil
+	}
+
+	ph, err := p.GetPhoneById(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return p.checkOwnerOf(actor, ph)
+}
+
+func (p *Phones) checkOwnerOf(actor entity.Actor, ph entity.Phone) error {
+	if !p.enforceOwnership || actor.IsAdmin() {
+		return nil
+	}
+
+	if ph.CreatedBy == nil || *ph.CreatedBy != actor.UserID {
+		return ErrNotOwner
+	}
+
+	return nil
 }
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"cmp"
+	"container/heap"
+	"crud-go/internal/entity"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// suggestIndex keeps the values of the suggest fields of the live phones,
+// sorted by their lower-cased form so that a prefix is a range of it. It
+// remembers what it recorded for every phone, so a change replaces the old
+// values without reading the phone again, and the version at which a phone
+// was deleted, so a late write of an older version doesn't bring it back.
+//
+// The index only sees the writes of its own process; other instances'
+// changes show up after a restart.
+type suggestIndex struct {
+	mu     sync.RWMutex
+	phones map[int]indexedPhone
+	fields map[string][]suggestEntry
+}
+
+type indexedPhone struct {
+	version int64
+	values  []string
+	deleted bool
+	// deletedAt tells when the tombstone can go: once the trash is purged
+	// of the phone, no write of it can come late any more.
+	deletedAt time.Time
+}
+
+type suggestEntry struct {
+	key   string
+	value string
+	count int
+}
+
+func newSuggestIndex() *suggestIndex {
+	return &suggestIndex{
+		phones: make(map[int]indexedPhone),
+		fields: make(map[string][]suggestEntry, len(entity.SuggestFields)),
+	}
+}
+
+func suggestValues(ph entity.Phone) []string {
+	return []string{ph.Brand, ph.Model, ph.Processor}
+}
+
+// put records the phone, replacing what was recorded for an older version
+// of it. Versions up to the one it was deleted at are ignored.
+func (s *suggestIndex) put(ph entity.Phone) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.phones[ph.Id]
+	if ok && old.version >= ph.Version {
+		return
+	}
+	if ok && !old.deleted {
+		s.removeValues(old.values)
+	}
+
+	values := suggestValues(ph)
+	s.phones[ph.Id] = indexedPhone{version: ph.Version, values: values}
+	for i, field := range entity.SuggestFields {
+		entries := s.fields[field]
+		key := strings.ToLower(values[i])
+		j, found := slices.BinarySearchFunc(entries, values[i], entryCmp(key))
+		if found {
+			entries[j].count++
+		} else {
+			s.fields[field] = slices.Insert(entries, j, suggestEntry{key: key, value: values[i], count: 1})
+		}
+	}
+}
+
+// remove drops the values of the phone deleted at the version and keeps a
+// tombstone in their place until purge.
+func (s *suggestIndex) remove(id int, version int64, deletedAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.phones[id]
+	if ok && old.version >= version {
+		return
+	}
+	if ok && !old.deleted {
+		s.removeValues(old.values)
+	}
+
+	s.phones[id] = indexedPhone{version: version, deleted: true, deletedAt: deletedAt}
+}
+
+// purge forgets the tombstones of the phones deleted before the time, which
+// the trash purge has removed for good.
+func (s *suggestIndex) purge(before time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, ph := range s.phones {
+		if ph.deleted && ph.deletedAt.Before(before) {
+			delete(s.phones, id)
+		}
+	}
+}
+
+func (s *suggestIndex) removeValues(values []string) {
+	for i, field := range entity.SuggestFields {
+		entries := s.fields[field]
+		j, found := slices.BinarySearchFunc(entries, values[i], entryCmp(strings.ToLower(values[i])))
+		if !found {
+			continue
+		}
+		if entries[j].count--; entries[j].count == 0 {
+			s.fields[field] = slices.Delete(entries, j, j+1)
+		}
+	}
+}
+
+// entryCmp orders the entries by key and, for values differing only in
+// case, by value.
+func entryCmp(key string) func(suggestEntry, string) int {
+	return func(e suggestEntry, value string) int {
+		return cmp.Or(strings.Compare(e.key, key), strings.Compare(e.value, value))
+	}
+}
+
+// suggest returns up to limit values of the field starting with prefix,
+// ignoring case, the most common first. Only the best limit values seen are
+// kept while scanning the prefix.
+func (s *suggestIndex) suggest(field, prefix string, limit int) []entity.Suggestion {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	prefix = strings.ToLower(prefix)
+	entries := s.fields[field]
+	start, _ := slices.BinarySearchFunc(entries, prefix, func(e suggestEntry, prefix string) int {
+		return strings.Compare(e.key, prefix)
+	})
+
+	top := make(topSuggestions, 0, limit)
+	for _, e := range entries[start:] {
+		if !strings.HasPrefix(e.key, prefix) {
+			break
+		}
+
+		sg := entity.Suggestion{Value: e.value, Count: e.count}
+		switch {
+		case len(top) < limit:
+			heap.Push(&top, sg)
+		case suggestionCmp(sg, top[0]) < 0:
+			top[0] = sg
+			heap.Fix(&top, 0)
+		}
+	}
+
+	slices.SortFunc(top, suggestionCmp)
+	return top
+}
+
+// suggestionCmp orders the suggestions the most common first, then by value.
+func suggestionCmp(a, b entity.Suggestion) int {
+	return cmp.Or(cmp.Compare(b.Count, a.Count), strings.Compare(a.Value, b.Value))
+}
+
+// topSuggestions is a heap of suggestions with the worst one on top.
+type topSuggestions []entity.Suggestion
+
+func (t topSuggestions) Len() int           { return len(t) }
+func (t topSuggestions) Less(i, j int) bool { return suggestionCmp(t[i], t[j]) > 0 }
+func (t topSuggestions) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t *topSuggestions) Push(x any)        { *t = append(*t, x.(entity.Suggestion)) }
+
+func (t *topSuggestions) Pop() any {
+	old := *t
+	x := old[len(old)-1]
+	*t = old[:len(old)-1]
+	return x
+}
+
+// reset takes over the contents of a freshly built index.
+func (s *suggestIndex) reset(fresh *suggestIndex) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.phones, s.fields = fresh.phones, fresh.fields
+}
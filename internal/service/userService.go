@@ -3,6 +3,11 @@ package service
 import (
 	"context"
 	"crud-go/internal/entity"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"strconv"
@@ -13,27 +18,88 @@ import (
 
 type PasswordHasher interface {
 	Hash(password string) (string, error)
+	Verify(password, hash string) (bool, error)
+	NeedsRehash(hash string) bool
 }
 
 type UsersRepository interface {
 	Create(ctx context.Context, user entity.User) error
-	GetByCredentials(ctx context.Context, email, password string) (entity.User, error)
+	GetByEmail(ctx context.Context, email string) (entity.User, error)
+	GetById(ctx context.Context, id int64) (entity.User, error)
+	UpdatePassword(ctx context.Context, id int64, password string) error
+	UpdateRole(ctx context.Context, id int64, role entity.Role) (bool, error)
+}
+
+type RefreshTokensRepository interface {
+	Create(ctx context.Context, token entity.RefreshToken) error
+	GetByHash(ctx context.Context, hash string) (entity.RefreshToken, error)
+	MarkUsed(ctx context.Context, id int64) (bool, error)
+	RevokeFamily(ctx context.Context, familyID string) error
+	RevokeUser(ctx context.Context, userID int64) error
+}
+
+type TokenRevocationStore interface {
+	RevokeToken(ctx context.Context, tokenID string, userID int64, expiresAt time.Time) error
+	// RevokeUserTokens revokes the tokens of the user issued at or before
+	// the time.
+	RevokeUserTokens(ctx context.Context, userID int64, before, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, tokenID string, userID int64, issuedAt time.Time) (bool, error)
+	PurgeExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+var (
+	ErrInvalidCredentials  = Unauthorized("invalid email or password")
+	ErrInvalidRefreshToken = Unauthorized("invalid refresh token")
+	ErrRefreshTokenReused  = Unauthorized("refresh token reused, session revoked")
+	ErrTokenRevoked        = Unauthorized("token revoked")
+	ErrUserNotFound        = NotFound("user not found")
+	ErrEmailTaken          = Conflict("email is already registered")
+)
+
+type accessClaims struct {
+	jwt.StandardClaims
+	SessionID string      `json:"sid"`
+	Role      entity.Role `json:"role"`
+	// IssuedAtMicro is the issue time in microseconds, the precision of the
+	// revocation cutoffs; iat only has whole seconds.
+	IssuedAtMicro int64 `json:"iat_us,omitempty"`
 }
 
 type User struct {
-	userRepository UsersRepository
-	hasher         PasswordHasher
+	userRepository    UsersRepository
+	refreshRepository RefreshTokensRepository
+	revocations       TokenRevocationStore
+	hasher            PasswordHasher
+
+	// dummyHash is verified against when the email is unknown, so that
+	// response time does not reveal which emails are registered.
+	dummyHash string
 
 	hmacSecret []byte
 	tokenTtl   time.Duration
+	refreshTtl time.Duration
 }
 
-func NewUser(userRepository UsersRepository, hasher PasswordHasher, hmacSecret []byte, tokenTtl time.Duration) *User {
-	return &User{userRepository: userRepository, hasher: hasher, hmacSecret: hmacSecret, tokenTtl: tokenTtl}
+func NewUser(userRepository UsersRepository, refreshRepository RefreshTokensRepository, revocations TokenRevocationStore,
+	hasher PasswordHasher, hmacSecret []byte, tokenTtl, refreshTtl time.Duration) *User {
+	dummyHash, _ := hasher.Hash("dummy password")
 
+	return &User{
+		userRepository:    userRepository,
+		refreshRepository: refreshRepository,
+		revocations:       revocations,
+		hasher:            hasher,
+		dummyHash:         dummyHash,
+		hmacSecret:        hmacSecret,
+		tokenTtl:          tokenTtl,
+		refreshTtl:        refreshTtl,
+	}
 }
 
 func (u *User) SignUp(ctx context.Context, input entity.SignUpInput) error {
+	ctx, span := tracer.Start(ctx, "User.SignUp")
+	defer span.End()
+
 	password, err := u.hasher.Hash(input.Password)
 	if err != nil {
 		return err
@@ -46,32 +112,160 @@ func (u *User) SignUp(ctx context.Context, input entity.SignUpInput) error {
 		RegisteredAt: time.Now(),
 	}
 
-	return u.userRepository.Create(ctx, user)
+	err = u.userRepository.Create(ctx, user)
+	if errors.Is(err, entity.ErrDuplicate) {
+		return ErrEmailTaken
+	}
+
+	return err
 }
 
-func (u *User) SignIn(ctx context.Context, input entity.SignInInput) (string, error) {
-	password, err := u.hasher.Hash(input.Password)
+func (u *User) SignIn(ctx context.Context, input entity.SignInInput) (entity.Tokens, error) {
+	ctx, span := tracer.Start(ctx, "User.SignIn")
+	defer span.End()
+
+	user, err := u.userRepository.GetByEmail(ctx, input.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		u.hasher.Verify(input.Password, u.dummyHash)
+		return entity.Tokens{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return entity.Tokens{}, err
+	}
+
+	ok, err := u.hasher.Verify(input.Password, user.Password)
+	if err != nil {
+		return entity.Tokens{}, err
+	}
+	if !ok {
+		return entity.Tokens{}, ErrInvalidCredentials
+	}
+
+	if u.hasher.NeedsRehash(user.Password) {
+		password, err := u.hasher.Hash(input.Password)
+		if err != nil {
+			return entity.Tokens{}, err
+		}
+
+		if err := u.userRepository.UpdatePassword(ctx, user.ID, password); err != nil {
+			return entity.Tokens{}, err
+		}
+	}
+
+	familyID, err := randomString(16)
+	if err != nil {
+		return entity.Tokens{}, err
+	}
+
+	return u.issueTokens(ctx, user, familyID)
+}
+
+// Refresh rotates a refresh token: the presented one is spent and a new pair
+// is issued in the same family. Presenting a spent token means it leaked, so
+// the whole family is revoked and the owner has to sign in again.
+func (u *User) Refresh(ctx context.Context, refreshToken string) (entity.Tokens, error) {
+	ctx, span := tracer.Start(ctx, "User.Refresh")
+	defer span.End()
+
+	stored, err := u.refreshRepository.GetByHash(ctx, hashToken(refreshToken))
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.Tokens{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return entity.Tokens{}, err
+	}
+
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return entity.Tokens{}, ErrInvalidRefreshToken
+	}
+
+	fresh := stored.UsedAt == nil
+	if fresh {
+		if fresh, err = u.refreshRepository.MarkUsed(ctx, stored.ID); err != nil {
+			return entity.Tokens{}, err
+		}
+	}
+
+	if !fresh {
+		if err := u.refreshRepository.RevokeFamily(ctx, stored.FamilyID); err != nil {
+			return entity.Tokens{}, err
+		}
+		return entity.Tokens{}, ErrRefreshTokenReused
+	}
+
+	// The role is read again so that role changes apply from the next refresh.
+	user, err := u.userRepository.GetById(ctx, stored.UserID)
+	if err != nil {
+		return entity.Tokens{}, err
+	}
+
+	return u.issueTokens(ctx, user, stored.FamilyID)
+}
+
+func (u *User) issueTokens(ctx context.Context, user entity.User, familyID string) (entity.Tokens, error) {
+	tokenID, err := randomString(16)
 	if err != nil {
-		return " ", err
+		return entity.Tokens{}, err
 	}
 
-	user, err := u.userRepository.GetByCredentials(ctx, input.Email, password)
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        tokenID,
+			Subject:   strconv.Itoa(int(user.ID)),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(u.tokenTtl).Unix(),
+		},
+		SessionID:     familyID,
+		Role:          user.Role,
+		IssuedAtMicro: now.UnixMicro(),
+	})
+
+	access, err := token.SignedString(u.hmacSecret)
 	if err != nil {
-		return " ", err
+		return entity.Tokens{}, err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
-		Subject:   strconv.Itoa(int(user.ID)),
-		IssuedAt:  time.Now().Unix(),
-		ExpiresAt: time.Now().Add(time.Minute * 15).Unix(),
+	refresh, err := randomString(32)
+	if err != nil {
+		return entity.Tokens{}, err
+	}
+
+	err = u.refreshRepository.Create(ctx, entity.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(refresh),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(u.refreshTtl),
 	})
+	if err != nil {
+		return entity.Tokens{}, err
+	}
+
+	return entity.Tokens{AccessToken: access, RefreshToken: refresh}, nil
+}
+
+func randomString(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
 
-	sig, _ := token.SignedString(u.hmacSecret)
-	return sig, nil
+// hashToken is what gets stored instead of the refresh token itself. The
+// tokens are random, so a plain SHA-256 is enough.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
-func (s *User) ParseToken(ctx context.Context, token string) (int64, error) {
-	t, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+func (s *User) ParseToken(ctx context.Context, token string) (entity.AccessClaims, error) {
+	ctx, span := tracer.Start(ctx, "User.ParseToken")
+	defer span.End()
+
+	var claims accessClaims
+	t, err := jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
 		}
@@ -79,27 +273,115 @@ func (s *User) ParseToken(ctx context.Context, token string) (int64, error) {
 		return s.hmacSecret, nil
 	})
 	if err != nil {
-		return 0, err
+		return entity.AccessClaims{}, &Error{Kind: KindUnauthorized, Detail: "invalid token", Err: err}
 	}
 
 	if !t.Valid {
-		return 0, errors.New("invalid token")
+		return entity.AccessClaims{}, Unauthorized("invalid token")
 	}
 
-	claims, ok := t.Claims.(jwt.MapClaims)
-	if !ok {
-		return 0, errors.New("invalid claims")
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return entity.AccessClaims{}, Unauthorized("invalid subject")
 	}
 
-	subject, ok := claims["sub"].(string)
-	if !ok {
-		return 0, errors.New("invalid subject")
+	if claims.Id == "" {
+		return entity.AccessClaims{}, Unauthorized("token has no id")
+	}
+
+	switch claims.Role {
+	case entity.RoleViewer, entity.RoleEditor, entity.RoleAdmin:
+	default:
+		return entity.AccessClaims{}, Unauthorized("invalid role")
 	}
 
-	id, err := strconv.Atoi(subject)
+	parsed := entity.AccessClaims{
+		UserID:    int64(id),
+		Role:      claims.Role,
+		TokenID:   claims.Id,
+		SessionID: claims.SessionID,
+		IssuedAt:  time.Unix(claims.IssuedAt, 0),
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}
+	// Tokens issued before iat_us existed count as issued at the end of
+	// their second, so a cutoff within that second revokes them.
+	if claims.IssuedAtMicro != 0 {
+		parsed.IssuedAt = time.UnixMicro(claims.IssuedAtMicro)
+	} else {
+		parsed.IssuedAt = parsed.IssuedAt.Add(time.Second - time.Microsecond)
+	}
+
+	revoked, err := s.revocations.IsRevoked(ctx, parsed.TokenID, parsed.UserID, parsed.IssuedAt)
 	if err != nil {
-		return 0, errors.New("invalid subject")
+		return entity.AccessClaims{}, err
 	}
+	if revoked {
+		return entity.AccessClaims{}, ErrTokenRevoked
+	}
+
+	return parsed, nil
+}
+
+// Logout revokes the given access token and the refresh tokens of its
+// session.
+func (u *User) Logout(ctx context.Context, claims entity.AccessClaims) error {
+	ctx, span := tracer.Start(ctx, "User.Logout")
+	defer span.End()
+
+	if err := u.revocations.RevokeToken(ctx, claims.TokenID, claims.UserID, claims.ExpiresAt); err != nil {
+		return err
+	}
+
+	if claims.SessionID == "" {
+		return nil
+	}
+
+	return u.refreshRepository.RevokeFamily(ctx, claims.SessionID)
+}
+
+// LogoutAll revokes every access and refresh token the user holds.
+func (u *User) LogoutAll(ctx context.Context, userID int64) error {
+	ctx, span := tracer.Start(ctx, "User.LogoutAll")
+	defer span.End()
+
+	if err := u.revokeUserTokens(ctx, userID); err != nil {
+		return err
+	}
+
+	return u.refreshRepository.RevokeUser(ctx, userID)
+}
+
+// SetRole changes the role of a user. Access tokens issued before carry the
+// old role, so they are revoked; refresh tokens stay valid and pick the new
+// role up on the next refresh.
+func (u *User) SetRole(ctx context.Context, userID int64, role entity.Role) error {
+	ctx, span := tracer.Start(ctx, "User.SetRole")
+	defer span.End()
+
+	found, err := u.userRepository.UpdateRole(ctx, userID, role)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrUserNotFound
+	}
+
+	return u.revokeUserTokens(ctx, userID)
+}
+
+// revokeUserTokens revokes the access tokens of the user issued up to now.
+// The cutoff is cut to microseconds like the issue times of the tokens and
+// the timestamps of the database.
+func (u *User) revokeUserTokens(ctx context.Context, userID int64) error {
+	now := time.Now()
+	return u.revocations.RevokeUserTokens(ctx, userID, now.Truncate(time.Microsecond), now.Add(u.tokenTtl))
+}
+
+// PurgeExpiredRevocations forgets revocations of tokens that have expired
+// and are rejected on their own.
+func (u *User) PurgeExpiredRevocations(ctx context.Context) (int64, error) {
+	ctx, span := tracer.Start(ctx, "User.PurgeExpiredRevocations")
+	defer span.End()
 
-	return int64(id), nil
+	return u.revocations.PurgeExpired(ctx, time.Now())
 }
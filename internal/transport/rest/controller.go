@@ -3,59 +3,137 @@ package rest
 import (
 	"context"
 	"crud-go/internal/entity"
+	"crud-go/pkg/health"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
 type PhonesService interface {
 	GetPhoneById(ctx context.Context, id int64) (entity.Phone, error)
-	GetAllPhones(ctx context.Context) ([]entity.Phone, error)
-	CreatePhone(ctx context.Context, ph entity.PhoneInputDto) error
-	UpdatePhoneById(ctx context.Context, id int64, ph entity.PhoneInputDto) error
-	DeletePhoneById(ctx context.Context, id int64) error
+	GetAllPhones(ctx context.Context, q entity.PhoneQuery) (entity.PhonePage, error)
+	CreatePhone(ctx context.Context, actor entity.Actor, ph entity.PhoneInputDto) (entity.Phone, error)
+	UpdatePhoneById(ctx context.Context, actor entity.Actor, id int64, ifMatch []int64, ph entity.PhoneInputDto) (entity.Phone, error)
+	PatchPhoneById(ctx context.Context, actor entity.Actor, id int64, ifMatch []int64, patch entity.PhonePatch) (entity.Phone, error)
+	DeletePhoneById(ctx context.Context, actor entity.Actor, id int64, ifMatch []int64) error
+	GetDeletedPhones(ctx context.Context, q entity.PhoneQuery) (entity.PhonePage, error)
+	RestorePhoneById(ctx context.Context, actor entity.Actor, id int64) (entity.Phone, error)
+	GetPhoneHistory(ctx context.Context, id int64) ([]entity.PhoneRevision, error)
+	GetPhoneRevision(ctx context.Context, id, revision int64) (entity.PhoneRevision, error)
+	RevertPhoneById(ctx context.Context, actor entity.Actor, id, revision int64, ifMatch []int64) (entity.Phone, error)
+	SearchPhones(ctx context.Context, q entity.PhoneSearchQuery) (entity.PhoneSearchResult, error)
+	GetPhoneFacets(ctx context.Context, q entity.PhoneFacetQuery) (entity.PhoneFacets, error)
+	SuggestPhoneValues(ctx context.Context, field, prefix string, limit int) ([]entity.Suggestion, error)
+	BulkWritePhones(ctx context.Context, actor entity.Actor, ops []entity.PhoneBulkOp, atomic, requireVersion bool) ([]entity.PhoneBulkResult, error)
+	ImportPhones(ctx context.Context, actor entity.Actor, rows entity.PhoneRowReader, dryRun bool) (entity.PhoneImportReport, error)
 }
 
 type UsersService interface {
 	SignUp(ctx context.Context, input entity.SignUpInput) error
-	SignIn(ctx context.Context, input entity.SignInInput) (string, error)
-	ParseToken(ctx context.Context, token string) (int64, error)
+	SignIn(ctx context.Context, input entity.SignInInput) (entity.Tokens, error)
+	Refresh(ctx context.Context, refreshToken string) (entity.Tokens, error)
+	ParseToken(ctx context.Context, token string) (entity.AccessClaims, error)
+	Logout(ctx context.Context, claims entity.AccessClaims) error
+	LogoutAll(ctx context.Context, userID int64) error
+	SetRole(ctx context.Context, userID int64, role entity.Role) error
+}
+
+// HealthRegistry runs the registered dependency checks.
+type HealthRegistry interface {
+	Check(ctx context.Context) health.Report
 }
 
 type Controller struct {
 	phonesService PhonesService
 	usersService  UsersService
+	health        HealthRegistry
+
+	// requireIfMatch makes changes of a phone without If-Match fail with
+	// 428 instead of overwriting whatever is stored.
+	requireIfMatch bool
+
+	// importTimeout is how long an import may take to upload and run, in
+	// place of the server timeouts.
+	importTimeout time.Duration
+
+	ready atomic.Bool
 }
 
-func NewController(phonesService PhonesService, usersService UsersService) *Controller {
+func NewController(phonesService PhonesService, usersService UsersService, health HealthRegistry, requireIfMatch bool, importTimeout time.Duration) *Controller {
 	return &Controller{
-		phonesService: phonesService,
-		usersService:  usersService,
+		phonesService:  phonesService,
+		usersService:   usersService,
+		health:         health,
+		requireIfMatch: requireIfMatch,
+		importTimeout:  importTimeout,
 	}
 }
 
+// SetReady switches what /readyz reports. The controller starts not ready.
+func (c *Controller) SetReady(ready bool) {
+	c.ready.Store(ready)
+}
+
 func (c *Controller) InitRouter() *mux.Router {
 	r := mux.NewRouter()
+	r.Use(requestIDMiddleware)
 	r.Use(loggingMiddleware)
+	r.Use(metricsMiddleware)
+	r.Use(tracingMiddleware)
+	// Middlewares only run for matched routes, so the fallbacks are wrapped
+	// to be logged and tagged too.
+	r.NotFoundHandler = requestIDMiddleware(loggingMiddleware(http.HandlerFunc(notFoundHandler)))
+	r.MethodNotAllowedHandler = requestIDMiddleware(loggingMiddleware(http.HandlerFunc(methodNotAllowedHandler)))
+
+	r.HandleFunc("/healthz", c.healthz).Methods(http.MethodGet)
+	r.HandleFunc("/readyz", c.readyz).Methods(http.MethodGet)
+	r.Handle("/metrics", promhttp.Handler()).Methods(http.MethodGet)
+
+	viewer := c.requireRole(entity.RoleViewer, entity.RoleEditor, entity.RoleAdmin)
+	editor := c.requireRole(entity.RoleEditor, entity.RoleAdmin)
+	admin := c.requireRole(entity.RoleAdmin)
+
+	// The details carry the errors of the dependencies, which can tell
+	// hosts and users of the backend.
+	r.Handle("/healthz/details", c.authMiddleware(admin(http.HandlerFunc(c.healthDetails)))).Methods(http.MethodGet)
 
 	auth := r.PathPrefix("/api/users").Subrouter()
 	{
 		auth.HandleFunc("/sign-up", c.signUp).Methods(http.MethodPost)
 		auth.HandleFunc("/sign-in", c.signIn).Methods(http.MethodPost)
+		auth.HandleFunc("/refresh", c.refresh).Methods(http.MethodPost)
+		auth.Handle("/logout", c.authMiddleware(http.HandlerFunc(c.logout))).Methods(http.MethodPost)
+		auth.Handle("/logout-all", c.authMiddleware(http.HandlerFunc(c.logoutAll))).Methods(http.MethodPost)
+		auth.Handle("/{id:[0-9]+}/role", c.authMiddleware(admin(http.HandlerFunc(c.setRole)))).Methods(http.MethodPut)
 	}
 
 	phones := r.PathPrefix("/api/phones").Subrouter()
 	{
 		phones.Use(c.authMiddleware)
-		phones.HandleFunc("", c.createPhone).Methods(http.MethodPost)
-		phones.HandleFunc("", c.getAllPhones).Methods(http.MethodGet)
-		phones.HandleFunc("/{id:[0-9]+", c.getPhoneById).Methods(http.MethodGet)
-		phones.HandleFunc("/{id:[0-9]+", c.deletePhoneById).Methods(http.MethodDelete)
-		phones.HandleFunc("/{id:[0-9]+", c.updatePhoneById).Methods(http.MethodPut)
+		phones.Handle("", editor(http.HandlerFunc(c.createPhone))).Methods(http.MethodPost)
+		phones.Handle("", viewer(http.HandlerFunc(c.getAllPhones))).Methods(http.MethodGet)
+		phones.Handle("/bulk", editor(http.HandlerFunc(c.bulkWritePhones))).Methods(http.MethodPost)
+		phones.Handle("/import", admin(http.HandlerFunc(c.importPhones))).Methods(http.MethodPost)
+		phones.Handle("/search", viewer(http.HandlerFunc(c.searchPhones))).Methods(http.MethodGet)
+		phones.Handle("/facets", viewer(http.HandlerFunc(c.getPhoneFacets))).Methods(http.MethodGet)
+		phones.Handle("/suggest", viewer(http.HandlerFunc(c.suggestPhoneValues))).Methods(http.MethodGet)
+		phones.Handle("/{id:[0-9]+}", viewer(http.HandlerFunc(c.getPhoneById))).Methods(http.MethodGet)
+		phones.Handle("/{id:[0-9]+}", editor(http.HandlerFunc(c.deletePhoneById))).Methods(http.MethodDelete)
+		phones.Handle("/{id:[0-9]+}", editor(http.HandlerFunc(c.updatePhoneById))).Methods(http.MethodPut)
+		phones.Handle("/{id:[0-9]+}", editor(http.HandlerFunc(c.patchPhoneById))).Methods(http.MethodPatch)
+		phones.Handle("/trash", admin(http.HandlerFunc(c.getDeletedPhones))).Methods(http.MethodGet)
+		phones.Handle("/{id:[0-9]+}/restore", admin(http.HandlerFunc(c.restorePhoneById))).Methods(http.MethodPost)
+		phones.Handle("/{id:[0-9]+}/history", viewer(http.HandlerFunc(c.getPhoneHistory))).Methods(http.MethodGet)
+		phones.Handle("/{id:[0-9]+}/history/{rev:[0-9]+}", viewer(http.HandlerFunc(c.getPhoneRevision))).Methods(http.MethodGet)
+		phones.Handle("/{id:[0-9]+}/revert/{rev:[0-9]+}", editor(http.HandlerFunc(c.revertPhoneById))).Methods(http.MethodPost)
 	}
 
 	r.PathPrefix("/swagger/").Handler(httpSwagger.Handler(
@@ -79,3 +157,62 @@ func getIdFromReq(r *http.Request) (int64, error) {
 
 	return id, nil
 }
+
+func getActorFromReq(r *http.Request) entity.Actor {
+	claims, _ := r.Context().Value(ctxClaims).(entity.AccessClaims)
+	return entity.Actor{UserID: claims.UserID, Role: claims.Role}
+}
+
+func getPhoneQueryFromReq(r *http.Request) (entity.PhoneQuery, error) {
+	values := r.URL.Query()
+
+	q := entity.PhoneQuery{
+		PhoneFilter: entity.PhoneFilter{
+			Brand:     values.Get("brand"),
+			Model:     values.Get("model"),
+			OS:        values.Get("os"),
+			Processor: values.Get("processor"),
+		},
+	}
+
+	var err error
+	if v := values.Get("owner"); v != "" {
+		if q.CreatedBy, err = strconv.ParseInt(v, 10, 64); err != nil || q.CreatedBy <= 0 {
+			return q, fmt.Errorf("invalid owner %q", v)
+		}
+	}
+
+	if v := values.Get("mine"); v != "" {
+		mine, err := strconv.ParseBool(v)
+		if err != nil {
+			return q, fmt.Errorf("invalid mine %q", v)
+		}
+		if mine {
+			q.CreatedBy = getActorFromReq(r).UserID
+		}
+	}
+
+	for name, dst := range map[string]*int{
+		"limit":     &q.Limit,
+		"year_from": &q.YearFrom,
+		"year_to":   &q.YearTo,
+	} {
+		if v := values.Get(name); v != "" {
+			if *dst, err = strconv.Atoi(v); err != nil || *dst < 0 {
+				return q, fmt.Errorf("invalid %s %q", name, v)
+			}
+		}
+	}
+
+	if q.Sort, err = entity.ParsePhoneSort(values.Get("sort")); err != nil {
+		return q, err
+	}
+
+	if cursor := values.Get("cursor"); cursor != "" {
+		if q.After, err = entity.DecodePhoneCursor(cursor, q.Sort); err != nil {
+			return q, err
+		}
+	}
+
+	return q, nil
+}
@@ -0,0 +1,85 @@
+package rest
+
+import (
+	"crud-go/internal/entity"
+	"crud-go/internal/service"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// phoneETag is the strong entity tag of a phone, its version.
+func phoneETag(ph entity.Phone) string {
+	return `"` + strconv.FormatInt(ph.Version, 10) + `"`
+}
+
+// contentETag is a strong entity tag for representations without a version,
+// like a page of the listing.
+func contentETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+func splitETags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// notModified tells whether If-None-Match matches etag, using the weak
+// comparison RFC 9110 prescribes for it.
+func notModified(r *http.Request, etag string) bool {
+	for _, tag := range splitETags(r.Header.Get("If-None-Match")) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getIfMatchFromReq returns the phone versions If-Match accepts. Nil means
+// any version: the header is absent (allowed unless requireIfMatch) or "*".
+func (c *Controller) getIfMatchFromReq(r *http.Request) ([]int64, error) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if c.requireIfMatch {
+			return nil, &requestError{
+				status: http.StatusPreconditionRequired,
+				kind:   "precondition-required",
+				err:    errors.New("If-Match with the ETag of the phone is required"),
+			}
+		}
+		return nil, nil
+	}
+
+	var versions []int64
+	for _, tag := range splitETags(header) {
+		if tag == "*" {
+			return nil, nil
+		}
+
+		// Weak tags never match in the strong comparison If-Match uses.
+		unquoted, ok := strings.CutPrefix(tag, `"`)
+		if !ok {
+			continue
+		}
+		if v, err := strconv.ParseInt(strings.TrimSuffix(unquoted, `"`), 10, 64); err == nil {
+			versions = append(versions, v)
+		}
+	}
+
+	if len(versions) == 0 {
+		return nil, service.PreconditionFailed("If-Match %s matches no version of the phone", header)
+	}
+
+	return versions, nil
+}
@@ -0,0 +1,84 @@
+package rest
+
+import (
+	"crud-go/pkg/health"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// DetailedHealth is the /healthz/details report, with whether the instance
+// currently takes traffic.
+type DetailedHealth struct {
+	health.Report
+	Ready bool `json:"ready"`
+}
+
+// @Summary Liveness
+// @Description Whether the process is alive. Doesn't look at dependencies.
+// @Tags Health
+// @Success 200 {string} string "OK"
+// @Router /healthz [get]
+func (c *Controller) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("OK"))
+}
+
+// @Summary Readiness
+// @Description Whether the instance accepts traffic. Fails while the server is starting or shutting down and while a dependency check fails.
+// @Tags Health
+// @Success 200 {string} string "OK"
+// @Failure 503 {object} Problem "Service Unavailable"
+// @Router /readyz [get]
+func (c *Controller) readyz(w http.ResponseWriter, r *http.Request) {
+	if !c.ready.Load() {
+		writeProblem(w, notReady(r, "the server is not ready to accept requests"))
+		return
+	}
+
+	if report := c.health.Check(r.Context()); report.Status != health.StatusUp {
+		writeProblem(w, notReady(r, "failing checks: "+strings.Join(report.Failed(), ", ")))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("OK"))
+}
+
+// @Summary Health details
+// @Description Result and latency of every dependency check, with the errors of the failing ones. Only for administrators.
+// @Tags Health
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} DetailedHealth
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 403 {object} Problem "Forbidden"
+// @Failure 503 {object} DetailedHealth
+// @Router /healthz/details [get]
+func (c *Controller) healthDetails(w http.ResponseWriter, r *http.Request) {
+	report := DetailedHealth{
+		Report: c.health.Check(r.Context()),
+		Ready:  c.ready.Load(),
+	}
+
+	response, err := json.Marshal(report)
+	if err != nil {
+		writeError(w, r, "healthDetails", "marshal error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != health.StatusUp {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(response)
+}
+
+func notReady(r *http.Request, detail string) Problem {
+	return newProblem(r, &requestError{
+		status: http.StatusServiceUnavailable,
+		kind:   "not-ready",
+		err:    errors.New(detail),
+	})
+}
@@ -0,0 +1,45 @@
+package rest
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Duration of HTTP requests by route template, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	signIns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_sign_ins_total",
+		Help: "Sign in attempts by result.",
+	}, []string{"result"})
+
+	tokenParseFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_token_parse_failures_total",
+		Help: "Requests rejected by the auth middleware by reason.",
+	}, []string{"reason"})
+)
+
+// metricsMiddleware observes the request duration. The route is labelled by
+// its template, e.g. /api/phones/{id:[0-9]+}, so ids don't explode the
+// number of series.
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := newResponseRecorder(w)
+
+		next.ServeHTTP(rec, r)
+
+		route := routeTemplate(r)
+
+		requestDuration.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).
+			Observe(time.Since(start).Seconds())
+	})
+}
@@ -2,10 +2,18 @@ package rest
 
 import (
 	"context"
+	"crud-go/internal/entity"
+	"crud-go/internal/service"
+	"crud-go/pkg/logging"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"net/http"
+	"regexp"
 	"strings"
+	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
 
@@ -13,15 +21,102 @@ type CtxValue int
 
 const (
 	ctxUserID CtxValue = iota
+	ctxClaims
+	ctxRequestID
 )
 
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID limits the ids accepted from clients, so they can't
+// inject anything into logs or response headers.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestIDMiddleware tags every request with an id that is echoed in the
+// response headers and in problem responses. An id set by the client or a
+// proxy in X-Request-ID is kept. The request gets a logger carrying the id.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), ctxRequestID, id)
+		ctx = logging.WithContext(ctx, logrus.WithFields(logrus.Fields{
+			"request_id":  id,
+			"method":      r.Method,
+			"route":       routeTemplate(r),
+			"remote_addr": r.RemoteAddr,
+		}))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// routeTemplate is the template of the matched route, e.g.
+// /api/phones/{id:[0-9]+}, or the path when no route matched.
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if tmpl, err := current.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+
+	return r.URL.Path
+}
+
+// responseRecorder remembers the status and the size of a response for the
+// middlewares that report on it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// loggingMiddleware writes the access log line once the response is sent.
+// Request headers are only logged at debug level, with credentials masked.
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logrus.WithFields(logrus.Fields{
-			"method": r.Method,
-			"URI":    r.RequestURI,
-		}).Info()
-		next.ServeHTTP(w, r)
+		start := time.Now()
+		rec := newResponseRecorder(w)
+
+		next.ServeHTTP(rec, r)
+
+		entry := logging.FromContext(r.Context()).WithFields(logrus.Fields{
+			"URI":        r.RequestURI,
+			"status":     rec.status,
+			"bytes":      rec.bytes,
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+		})
+		if entry.Logger.IsLevelEnabled(logrus.DebugLevel) {
+			entry = entry.WithField("headers", logging.RedactHeaders(r.Header))
+		}
+		entry.Info("request handled")
 	})
 }
 
@@ -29,31 +124,67 @@ func (c *Controller) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token, err := getTokenFromRequest(r)
 		if err != nil {
-			logrus.WithFields(logrus.Fields{
-				"handler": "authMiddleware",
-				"problem": "getTokenFromRequest error",
-			}).Error(err)
-			w.WriteHeader(http.StatusUnauthorized)
+			tokenParseFailures.WithLabelValues("header").Inc()
+			writeError(w, r, "authMiddleware", "getTokenFromRequest error",
+				&service.Error{Kind: service.KindUnauthorized, Detail: err.Error()})
 			return
 		}
 
-		userId, err := c.usersService.ParseToken(r.Context(), token)
+		claims, err := c.usersService.ParseToken(r.Context(), token)
 		if err != nil {
-			logrus.WithFields(logrus.Fields{
-				"handler": "authMiddleware",
-				"problem": "service error",
-			}).Error(err)
-			w.WriteHeader(http.StatusUnauthorized)
+			tokenParseFailures.WithLabelValues(tokenFailureReason(err)).Inc()
+			writeError(w, r, "authMiddleware", "service error", err)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), ctxUserID, userId)
+		logging.AddFields(r.Context(), logrus.Fields{
+			"user_id": claims.UserID,
+		})
+
+		ctx := context.WithValue(r.Context(), ctxUserID, claims.UserID)
+		ctx = context.WithValue(ctx, ctxClaims, claims)
 		r = r.WithContext(ctx)
 
 		next.ServeHTTP(w, r)
 	})
 }
 
+func tokenFailureReason(err error) string {
+	switch {
+	case errors.Is(err, service.ErrTokenRevoked):
+		return "revoked"
+	case service.ErrorKindOf(err) == service.KindUnauthorized:
+		return "invalid"
+	default:
+		return "error"
+	}
+}
+
+// requireRole lets the request through only when the caller has one of the
+// roles. It must run after authMiddleware: a missing or bad token is 401,
+// a valid token without the role is 403.
+func (c *Controller) requireRole(roles ...entity.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(ctxClaims).(entity.AccessClaims)
+			if !ok {
+				writeError(w, r, "requireRole", "no claims", service.Unauthorized("authentication required"))
+				return
+			}
+
+			for _, role := range roles {
+				if claims.Role == role {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			writeError(w, r, "requireRole", "insufficient role",
+				service.Forbidden("role %q is not allowed to %s %s", claims.Role, r.Method, r.URL.Path))
+		})
+	}
+}
+
 func getTokenFromRequest(r *http.Request) (string, error) {
 	header := r.Header.Get("Authorization")
 	if header == "" {
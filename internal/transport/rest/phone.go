@@ -1,54 +1,57 @@
 package rest
 
 import (
-	"context"
 	"crud-go/internal/entity"
+	"crud-go/internal/service"
 	"encoding/json"
+	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"strconv"
 
 	_ "crud-go/docs"
-
-	"github.com/sirupsen/logrus"
 )
 
 // @Summary Get a phone by ID
 // @Description Retrieve a phone record by its ID
 // @Tags Phones
+// @Security BearerAuth
 // @Accept json
 // @Produce json
 // @Param id path int true "Phone ID"
+// @Param If-None-Match header string false "ETag of a copy the client has"
 // @Success 200 {object} entity.Phone "OK"
-// @Failure 400 {string} string "Bad Request"
+// @Header 200 {string} ETag "Version of the phone"
+// @Success 304 "Not Modified"
+// @Failure 400 {object} Problem "Bad Request"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 404 {object} Problem "Not Found"
+// @Failure 500 {object} Problem "Internal Server Error"
 // @Router /api/phones/{id} [get]
 func (c *Controller) getPhoneById(w http.ResponseWriter, r *http.Request) {
 	id, err := getIdFromReq(r)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"handler": "getPhoneById",
-			"problem": "getting id from request",
-		}).Error(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, "getPhoneById", "getting id from request", badRequest(err))
 		return
 	}
 
-	book, err := c.phonesService.GetPhoneById(context.TODO(), id)
+	book, err := c.phonesService.GetPhoneById(r.Context(), id)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"handler": "getPhoneById",
-			"problem": "service error",
-		}).Error(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, "getPhoneById", "service error", err)
+		return
+	}
+
+	etag := phoneETag(book)
+	w.Header().Set("ETag", etag)
+	if notModified(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
 	response, err := json.Marshal(book)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"handler": "getPhoneById",
-			"problem": "marshal error",
-		}).Error(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, "getPhoneById", "marshal error", err)
 		return
 	}
 
@@ -56,32 +59,70 @@ func (c *Controller) getPhoneById(w http.ResponseWriter, r *http.Request) {
 	w.Write(response)
 }
 
+// checkOwnerFilter allows only administrators to look at the phones of
+// other users.
+func checkOwnerFilter(r *http.Request, createdBy int64) error {
+	actor := getActorFromReq(r)
+	if createdBy != 0 && createdBy != actor.UserID && !actor.IsAdmin() {
+		return service.Forbidden("only administrators can list phones of other users")
+	}
+
+	return nil
+}
+
 // @Summary Get all phones
-// @Description Retrieve all phone records
+// @Description Retrieve a page of phone records, optionally filtered and sorted
 // @Tags Phones
+// @Security BearerAuth
 // @Accept json
 // @Produce json
-// @Success 200 {array} entity.Phone "OK"
-// @Failure 500 {string} string "Internal Server Error"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param brand query string false "Brand"
+// @Param model query string false "Model"
+// @Param os query string false "Operating system"
+// @Param processor query string false "Processor"
+// @Param year_from query int false "Minimal release year"
+// @Param year_to query int false "Maximal release year"
+// @Param sort query string false "Sort field: id, brand, model, year, os or processor; prefix with - for descending"
+// @Param mine query bool false "Only phones created by the caller"
+// @Param owner query int false "Only phones created by the user; other users than the caller require the admin role"
+// @Param If-None-Match header string false "ETag of a copy of the page the client has"
+// @Success 200 {object} entity.PhonePage "OK"
+// @Header 200 {string} ETag "Hash of the page"
+// @Success 304 "Not Modified"
+// @Failure 400 {object} Problem "Bad Request"
+// @Failure 403 {object} Problem "Forbidden"
+// @Failure 500 {object} Problem "Internal Server Error"
 // @Router /api/phones [get]
 func (c *Controller) getAllPhones(w http.ResponseWriter, r *http.Request) {
-	phones, err := c.phonesService.GetAllPhones(context.TODO())
+	query, err := getPhoneQueryFromReq(r)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"handler": "getAllPhones",
-			"problem": "service error",
-		}).Error(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, "getAllPhones", "parsing query", badRequest(err))
+		return
+	}
+
+	if err := checkOwnerFilter(r, query.CreatedBy); err != nil {
+		writeError(w, r, "getAllPhones", "listing phones of another user", err)
+		return
+	}
+
+	phones, err := c.phonesService.GetAllPhones(r.Context(), query)
+	if err != nil {
+		writeError(w, r, "getAllPhones", "service error", err)
 		return
 	}
 
 	response, err := json.Marshal(phones)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"handler": "getAllPhones",
-			"problem": "marshal error",
-		}).Error(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, "getAllPhones", "marshal error", err)
+		return
+	}
+
+	etag := contentETag(response)
+	w.Header().Set("ETag", etag)
+	if notModified(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
@@ -92,12 +133,18 @@ func (c *Controller) getAllPhones(w http.ResponseWriter, r *http.Request) {
 // @Summary Create a new phone
 // @Description Create a new phone record
 // @Tags Phones
+// @Security BearerAuth
 // @Accept json
 // @Produce json
 // @Param phone body entity.PhoneInputDto true "Phone Data"
-// @Success 201 {string} string "Created"
-// @Failure 400 {string} string "Bad Request"
-// @Failure 500 {string} string "Internal Server Error"
+// @Param Accept-Language header string false "Language of validation messages: en or ru"
+// @Success 201 {object} entity.Phone "Created"
+// @Header 201 {string} Location "URL of the new phone"
+// @Header 201 {string} ETag "Version of the phone"
+// @Failure 400 {object} Problem "Bad Request"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 403 {object} Problem "Forbidden"
+// @Failure 500 {object} Problem "Internal Server Error"
 // @Router /api/phones [post]
 func (c *Controller) createPhone(w http.ResponseWriter, r *http.Request) {
 	var phone entity.PhoneInputDto
@@ -105,58 +152,66 @@ func (c *Controller) createPhone(w http.ResponseWriter, r *http.Request) {
 	reqBytes, err := io.ReadAll(r.Body)
 
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"handler": "createPhone",
-			"problem": "reading body",
-		}).Error(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, "createPhone", "reading body", badRequest(err))
 		return
 	}
 
 	err = json.Unmarshal(reqBytes, &phone)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"handler": "createPhone",
-			"problem": "unmarshal error",
-		}).Error(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, "createPhone", "unmarshal error", badRequest(err))
+		return
+	}
+
+	created, err := c.phonesService.CreatePhone(r.Context(), getActorFromReq(r), phone)
+	if err != nil {
+		writeError(w, r, "createPhone", "service error", err)
 		return
 	}
 
-	err = c.phonesService.CreatePhone(context.TODO(), phone)
+	response, err := json.Marshal(created)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"handler": "createPhone",
-			"problem": "service error",
-		}).Error(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, "createPhone", "marshal error", err)
 		return
 	}
 
+	w.Header().Set("Location", phoneLocation(created))
+	w.Header().Set("ETag", phoneETag(created))
+	w.Header().Add("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
+	w.Write(response)
 }
 
 // @Summary Update a phone by ID
 // @Description Update an existing phone record
 // @Tags Phones
+// @Security BearerAuth
 // @Accept json
 // @Produce json
 // @Param id path int true "Phone ID"
 // @Param phone body entity.PhoneInputDto true "Phone Data"
-// @Success 200 {string} string "OK"
-// @Failure 400 {string} string "Bad Request"
-// @Router /api/phones/{id} [put]neInputDto true "Phone Data"
-// @Success 200 {string} string "OK"
-// @Failure 400 {string} string "Bad Request"
+// @Param If-Match header string false "ETag of the phone the change is based on"
+// @Param Accept-Language header string false "Language of validation messages: en or ru"
+// @Success 200 {object} entity.Phone "OK"
+// @Header 200 {string} Location "URL of the phone"
+// @Header 200 {string} ETag "New version of the phone"
+// @Failure 400 {object} Problem "Bad Request"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 403 {object} Problem "Forbidden"
+// @Failure 404 {object} Problem "Not Found"
+// @Failure 412 {object} Problem "The phone was changed since the client read it"
+// @Failure 428 {object} Problem "If-Match is required"
+// @Failure 500 {object} Problem "Internal Server Error"
 // @Router /api/phones/{id} [put]
 func (c *Controller) updatePhoneById(w http.ResponseWriter, r *http.Request) {
 	id, err := getIdFromReq(r)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"handler": "updatePhoneById",
-			"problem": "getting id from request",
-		}).Error(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, "updatePhoneById", "getting id from request", badRequest(err))
+		return
+	}
+
+	ifMatch, err := c.getIfMatchFromReq(r)
+	if err != nil {
+		writeError(w, r, "updatePhoneById", "checking preconditions", err)
 		return
 	}
 
@@ -164,58 +219,234 @@ func (c *Controller) updatePhoneById(w http.ResponseWriter, r *http.Request) {
 
 	reqBytes, err := io.ReadAll(r.Body)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"handler": "updatePhoneById",
-			"problem": "reading body",
-		}).Error(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, "updatePhoneById", "reading body", badRequest(err))
 		return
 	}
 
 	err = json.Unmarshal(reqBytes, &phone)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"handler": "updatePhoneById",
-			"problem": "unmarshal error",
-		}).Error(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, "updatePhoneById", "unmarshal error", badRequest(err))
 		return
 	}
 
-	c.phonesService.UpdatePhoneById(context.TODO(), id, phone)
-	w.WriteHeader(http.StatusOK)
+	updated, err := c.phonesService.UpdatePhoneById(r.Context(), getActorFromReq(r), id, ifMatch, phone)
+	if err != nil {
+		writeError(w, r, "updatePhoneById", "service error", err)
+		return
+	}
+
+	response, err := json.Marshal(updated)
+	if err != nil {
+		writeError(w, r, "updatePhoneById", "marshal error", err)
+		return
+	}
+
+	w.Header().Set("Location", phoneLocation(updated))
+	w.Header().Set("ETag", phoneETag(updated))
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func phoneLocation(ph entity.Phone) string {
+	return "/api/phones/" + strconv.Itoa(ph.Id)
+}
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// @Summary Partially update a phone by ID
+// @Description Change only some fields of a phone with a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902). A field set to null or removed is cleared, which fails validation since every field is required.
+// @Tags Phones
+// @Security BearerAuth
+// @Accept application/merge-patch+json
+// @Accept application/json-patch+json
+// @Produce json
+// @Param id path int true "Phone ID"
+// @Param patch body entity.PhonePatch true "Fields to change"
+// @Param If-Match header string false "ETag of the phone the change is based on"
+// @Param Accept-Language header string false "Language of validation messages: en or ru"
+// @Success 200 {object} entity.Phone "OK"
+// @Header 200 {string} ETag "New version of the phone"
+// @Failure 400 {object} Problem "Bad Request"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 403 {object} Problem "Forbidden"
+// @Failure 404 {object} Problem "Not Found"
+// @Failure 409 {object} Problem "A JSON Patch test failed, or the phone kept changing"
+// @Failure 412 {object} Problem "The phone was changed since the client read it"
+// @Failure 415 {object} Problem "Unsupported Media Type"
+// @Failure 428 {object} Problem "If-Match is required"
+// @Failure 500 {object} Problem "Internal Server Error"
+// @Router /api/phones/{id} [patch]
+func (c *Controller) patchPhoneById(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromReq(r)
+	if err != nil {
+		writeError(w, r, "patchPhoneById", "getting id from request", badRequest(err))
+		return
+	}
+
+	ifMatch, err := c.getIfMatchFromReq(r)
+	if err != nil {
+		writeError(w, r, "patchPhoneById", "checking preconditions", err)
+		return
+	}
+
+	reqBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, "patchPhoneById", "reading body", badRequest(err))
+		return
+	}
+
+	var patch entity.PhonePatch
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case mergePatchContentType, "application/json":
+		patch, err = entity.ParsePhoneMergePatch(reqBytes)
+	case jsonPatchContentType:
+		patch, err = entity.ParsePhoneJSONPatch(reqBytes)
+	default:
+		writeError(w, r, "patchPhoneById", "content type", unsupportedMediaType(
+			fmt.Errorf("expected %s or %s, got %q", mergePatchContentType, jsonPatchContentType, mediaType)))
+		return
+	}
+	if err != nil {
+		writeError(w, r, "patchPhoneById", "unmarshal error", badRequest(err))
+		return
+	}
+
+	phone, err := c.phonesService.PatchPhoneById(r.Context(), getActorFromReq(r), id, ifMatch, patch)
+	if err != nil {
+		writeError(w, r, "patchPhoneById", "service error", err)
+		return
+	}
+
+	response, err := json.Marshal(phone)
+	if err != nil {
+		writeError(w, r, "patchPhoneById", "marshal error", err)
+		return
+	}
+
+	w.Header().Set("Location", phoneLocation(phone))
+	w.Header().Set("ETag", phoneETag(phone))
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
 }
 
 // @Summary Delete a phone by ID
-// @Description Delete a phone record by its ID
+// @Description Move a phone record to the trash. Administrators can restore it until it is purged.
 // @Tags Phones
+// @Security BearerAuth
 // @Accept json
 // @Produce json
 // @Param id path int true "Phone ID"
+// @Param If-Match header string false "ETag of the phone the deletion is based on"
 // @Success 200 {string} string "OK"
-// @Failure 400 {string} string "Bad Request"
-// @Failure 500 {string} string "Internal Server Error"
+// @Failure 400 {object} Problem "Bad Request"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 403 {object} Problem "Forbidden"
+// @Failure 404 {object} Problem "Not Found"
+// @Failure 412 {object} Problem "The phone was changed since the client read it"
+// @Failure 428 {object} Problem "If-Match is required"
+// @Failure 500 {object} Problem "Internal Server Error"
 // @Router /api/phones/{id} [delete]
 func (c *Controller) deletePhoneById(w http.ResponseWriter, r *http.Request) {
 	id, err := getIdFromReq(r)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"handler": "deletePhoneById",
-			"problem": "getting id from request",
-		}).Error(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, "deletePhoneById", "getting id from request", badRequest(err))
+		return
+	}
+
+	ifMatch, err := c.getIfMatchFromReq(r)
+	if err != nil {
+		writeError(w, r, "deletePhoneById", "checking preconditions", err)
 		return
 	}
 
-	err = c.phonesService.DeletePhoneById(context.TODO(), id)
+	err = c.phonesService.DeletePhoneById(r.Context(), getActorFromReq(r), id, ifMatch)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"handler": "deletePhoneById",
-			"problem": "service error",
-		}).Error(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, "deletePhoneById", "service error", err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// @Summary List deleted phones
+// @Description Retrieve a page of the phones in the trash. Takes the same parameters as the listing of phones.
+// @Tags Phones
+// @Security BearerAuth
+// @Produce json
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field: id, brand, model, year, os or processor; prefix with - for descending"
+// @Param owner query int false "Only phones created by the user"
+// @Success 200 {object} entity.PhonePage "OK"
+// @Failure 400 {object} Problem "Bad Request"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 403 {object} Problem "Forbidden"
+// @Failure 500 {object} Problem "Internal Server Error"
+// @Router /api/phones/trash [get]
+func (c *Controller) getDeletedPhones(w http.ResponseWriter, r *http.Request) {
+	query, err := getPhoneQueryFromReq(r)
+	if err != nil {
+		writeError(w, r, "getDeletedPhones", "parsing query", badRequest(err))
+		return
+	}
+
+	phones, err := c.phonesService.GetDeletedPhones(r.Context(), query)
+	if err != nil {
+		writeError(w, r, "getDeletedPhones", "service error", err)
+		return
+	}
+
+	response, err := json.Marshal(phones)
+	if err != nil {
+		writeError(w, r, "getDeletedPhones", "marshal error", err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// @Summary Restore a deleted phone
+// @Description Take a phone out of the trash
+// @Tags Phones
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Phone ID"
+// @Success 200 {object} entity.Phone "OK"
+// @Header 200 {string} Location "URL of the phone"
+// @Header 200 {string} ETag "New version of the phone"
+// @Failure 400 {object} Problem "Bad Request"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 403 {object} Problem "Forbidden"
+// @Failure 404 {object} Problem "Not Found"
+// @Failure 500 {object} Problem "Internal Server Error"
+// @Router /api/phones/{id}/restore [post]
+func (c *Controller) restorePhoneById(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromReq(r)
+	if err != nil {
+		writeError(w, r, "restorePhoneById", "getting id from request", badRequest(err))
+		return
+	}
+
+	phone, err := c.phonesService.RestorePhoneById(r.Context(), getActorFromReq(r), id)
+	if err != nil {
+		writeError(w, r, "restorePhoneById", "service error", err)
+		return
+	}
+
+	response, err := json.Marshal(phone)
+	if err != nil {
+		writeError(w, r, "restorePhoneById", "marshal error", err)
+		return
+	}
+
+	w.Header().Set("Location", phoneLocation(phone))
+	w.Header().Set("ETag", phoneETag(phone))
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
@@ -0,0 +1,135 @@
+package rest
+
+import (
+	"crud-go/internal/entity"
+	"crud-go/internal/service"
+	"crud-go/pkg/logging"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxBulkBody bounds the body of a bulk write: MaxBulkOps operations with
+// phones at their longest, escaped, fit in it.
+const maxBulkBody = service.MaxBulkOps * 4 << 10
+
+// BulkItemResult is the outcome of one operation: the phone for a create
+// or an update, the problem for a failure.
+type BulkItemResult struct {
+	Index  int               `json:"index"`
+	Action entity.BulkAction `json:"action"`
+	ID     int64             `json:"id,omitempty"`
+	Status int               `json:"status"`
+	Phone  *entity.Phone     `json:"phone,omitempty"`
+	Error  *Problem          `json:"error,omitempty"`
+}
+
+type BulkResponse struct {
+	Atomic    bool             `json:"atomic"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Results   []BulkItemResult `json:"results"`
+}
+
+var bulkStatuses = map[entity.BulkAction]int{
+	entity.BulkCreate: http.StatusCreated,
+	entity.BulkUpdate: http.StatusOK,
+	entity.BulkDelete: http.StatusNoContent,
+}
+
+// @Summary Create, update and delete phones in bulk
+// @Description Runs the operations in order. With atomic=true either all of them succeed or nothing is written and the problem names the failing operation. Otherwise each operation succeeds or fails on its own, and the results carry an HTTP-like status and, for failures, a problem per operation
+// @Tags Phones
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param atomic query bool false "Write all operations or none"
+// @Param operations body []entity.PhoneBulkOp true "Operations: create with phone, update with id and phone, delete with id; version works like If-Match"
+// @Param Accept-Language header string false "Language of validation messages: en or ru"
+// @Success 200 {object} BulkResponse "OK"
+// @Failure 400 {object} Problem "Bad Request"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 403 {object} Problem "Forbidden"
+// @Failure 404 {object} Problem "Not Found"
+// @Failure 412 {object} Problem "A phone was changed since the client read it"
+// @Failure 413 {object} Problem "Request Entity Too Large"
+// @Failure 428 {object} Problem "An update or a delete has no version, which the server requires"
+// @Failure 500 {object} Problem "Internal Server Error"
+// @Router /api/phones/bulk [post]
+func (c *Controller) bulkWritePhones(w http.ResponseWriter, r *http.Request) {
+	atomic := false
+	if v := r.URL.Query().Get("atomic"); v != "" {
+		var err error
+		if atomic, err = strconv.ParseBool(v); err != nil {
+			writeError(w, r, "bulkWritePhones", "parsing query", badRequest(fmt.Errorf("invalid atomic %q", v)))
+			return
+		}
+	}
+
+	var ops []entity.PhoneBulkOp
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBulkBody)).Decode(&ops)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, r, "bulkWritePhones", "body too large", payloadTooLarge(
+			fmt.Errorf("the body is larger than %d bytes, send at most %d operations", tooLarge.Limit, service.MaxBulkOps)))
+		return
+	}
+	if err != nil {
+		writeError(w, r, "bulkWritePhones", "unmarshal error", badRequest(err))
+		return
+	}
+
+	results, err := c.phonesService.BulkWritePhones(r.Context(), getActorFromReq(r), ops, atomic, c.requireIfMatch)
+	if err != nil {
+		writeError(w, r, "bulkWritePhones", "service error", err)
+		return
+	}
+
+	resp := BulkResponse{Atomic: atomic, Results: make([]BulkItemResult, len(results))}
+	for i, res := range results {
+		item := BulkItemResult{
+			Index:  res.Index,
+			Action: res.Action,
+			ID:     res.ID,
+			Status: bulkStatuses[res.Action],
+		}
+		if res.Action != entity.BulkDelete {
+			item.Phone = res.Phone
+		}
+
+		if res.Err != nil {
+			p := newProblem(r, res.Err)
+			item.Status, item.Error = p.Status, &p
+			resp.Failed++
+
+			entry := logging.FromContext(r.Context()).WithFields(logrus.Fields{
+				"handler": "bulkWritePhones",
+				"problem": "operation failed",
+				"index":   res.Index,
+				"status":  p.Status,
+			})
+			if p.Status >= http.StatusInternalServerError {
+				entry.Error(res.Err)
+			} else {
+				entry.Warn(res.Err)
+			}
+		} else {
+			resp.Succeeded++
+		}
+
+		resp.Results[i] = item
+	}
+
+	response, err := json.Marshal(resp)
+	if err != nil {
+		writeError(w, r, "bulkWritePhones", "marshal error", err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
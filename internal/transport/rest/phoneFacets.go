@@ -0,0 +1,81 @@
+package rest
+
+import (
+	"crud-go/internal/entity"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+func getPhoneFacetQueryFromReq(r *http.Request) (entity.PhoneFacetQuery, error) {
+	var q entity.PhoneFacetQuery
+
+	listing, err := getPhoneQueryFromReq(r)
+	if err != nil {
+		return q, err
+	}
+	q.PhoneFilter = listing.PhoneFilter
+
+	values := r.URL.Query()
+	if q.Fields, err = entity.ParsePhoneFacetFields(values.Get("fields")); err != nil {
+		return q, err
+	}
+
+	if v := values.Get("year_interval"); v != "" {
+		if q.YearInterval, err = strconv.Atoi(v); err != nil || q.YearInterval < 0 {
+			return q, fmt.Errorf("invalid year_interval %q", v)
+		}
+	}
+
+	return q, nil
+}
+
+// @Summary Count phones by field
+// @Description Number of phones per brand, OS, processor and release year, filtered like the listing. Years are counted in buckets of year_interval years
+// @Tags Phones
+// @Security BearerAuth
+// @Produce json
+// @Param fields query string false "Comma separated facets: brand, os, processor, year (default all)"
+// @Param year_interval query int false "Width of the year buckets in years (default 1, max 100)"
+// @Param brand query string false "Brand"
+// @Param model query string false "Model"
+// @Param os query string false "Operating system"
+// @Param processor query string false "Processor"
+// @Param year_from query int false "Minimal release year"
+// @Param year_to query int false "Maximal release year"
+// @Param mine query bool false "Only phones created by the caller"
+// @Param owner query int false "Only phones created by the user; other users than the caller require the admin role"
+// @Success 200 {object} entity.PhoneFacets "OK"
+// @Failure 400 {object} Problem "Bad Request"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 403 {object} Problem "Forbidden"
+// @Failure 500 {object} Problem "Internal Server Error"
+// @Router /api/phones/facets [get]
+func (c *Controller) getPhoneFacets(w http.ResponseWriter, r *http.Request) {
+	query, err := getPhoneFacetQueryFromReq(r)
+	if err != nil {
+		writeError(w, r, "getPhoneFacets", "parsing query", badRequest(err))
+		return
+	}
+
+	if err := checkOwnerFilter(r, query.CreatedBy); err != nil {
+		writeError(w, r, "getPhoneFacets", "counting phones of another user", err)
+		return
+	}
+
+	facets, err := c.phonesService.GetPhoneFacets(r.Context(), query)
+	if err != nil {
+		writeError(w, r, "getPhoneFacets", "service error", err)
+		return
+	}
+
+	response, err := json.Marshal(facets)
+	if err != nil {
+		writeError(w, r, "getPhoneFacets", "marshal error", err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
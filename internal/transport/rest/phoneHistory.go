@@ -0,0 +1,157 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+func getRevisionFromReq(r *http.Request) (int64, error) {
+	rev, err := strconv.ParseInt(mux.Vars(r)["rev"], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	if rev == 0 {
+		return 0, errors.New("revision can't be 0")
+	}
+
+	return rev, nil
+}
+
+// @Summary Get the history of a phone
+// @Description Every recorded change of a phone, oldest first, with who made it, the state before and after and the changed fields
+// @Tags Phones
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Phone ID"
+// @Success 200 {array} entity.PhoneRevision "OK"
+// @Failure 400 {object} Problem "Bad Request"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 404 {object} Problem "Not Found"
+// @Failure 500 {object} Problem "Internal Server Error"
+// @Router /api/phones/{id}/history [get]
+func (c *Controller) getPhoneHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromReq(r)
+	if err != nil {
+		writeError(w, r, "getPhoneHistory", "getting id from request", badRequest(err))
+		return
+	}
+
+	revisions, err := c.phonesService.GetPhoneHistory(r.Context(), id)
+	if err != nil {
+		writeError(w, r, "getPhoneHistory", "service error", err)
+		return
+	}
+
+	response, err := json.Marshal(revisions)
+	if err != nil {
+		writeError(w, r, "getPhoneHistory", "marshal error", err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// @Summary Get a revision of a phone
+// @Description One recorded change of a phone
+// @Tags Phones
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Phone ID"
+// @Param rev path int true "Revision"
+// @Success 200 {object} entity.PhoneRevision "OK"
+// @Failure 400 {object} Problem "Bad Request"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 404 {object} Problem "Not Found"
+// @Failure 500 {object} Problem "Internal Server Error"
+// @Router /api/phones/{id}/history/{rev} [get]
+func (c *Controller) getPhoneRevision(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromReq(r)
+	if err != nil {
+		writeError(w, r, "getPhoneRevision", "getting id from request", badRequest(err))
+		return
+	}
+
+	rev, err := getRevisionFromReq(r)
+	if err != nil {
+		writeError(w, r, "getPhoneRevision", "getting revision from request", badRequest(err))
+		return
+	}
+
+	revision, err := c.phonesService.GetPhoneRevision(r.Context(), id, rev)
+	if err != nil {
+		writeError(w, r, "getPhoneRevision", "service error", err)
+		return
+	}
+
+	response, err := json.Marshal(revision)
+	if err != nil {
+		writeError(w, r, "getPhoneRevision", "marshal error", err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// @Summary Revert a phone to a revision
+// @Description Update a phone to the state it had at a revision. The revert is recorded as a new revision.
+// @Tags Phones
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Phone ID"
+// @Param rev path int true "Revision"
+// @Param If-Match header string false "ETag of the phone the revert is based on"
+// @Param Accept-Language header string false "Language of validation messages: en or ru"
+// @Success 200 {object} entity.Phone "OK"
+// @Header 200 {string} Location "URL of the phone"
+// @Header 200 {string} ETag "New version of the phone"
+// @Failure 400 {object} Problem "Bad Request"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 403 {object} Problem "Forbidden"
+// @Failure 404 {object} Problem "Not Found"
+// @Failure 412 {object} Problem "The phone was changed since the client read it"
+// @Failure 428 {object} Problem "If-Match is required"
+// @Failure 500 {object} Problem "Internal Server Error"
+// @Router /api/phones/{id}/revert/{rev} [post]
+func (c *Controller) revertPhoneById(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromReq(r)
+	if err != nil {
+		writeError(w, r, "revertPhoneById", "getting id from request", badRequest(err))
+		return
+	}
+
+	rev, err := getRevisionFromReq(r)
+	if err != nil {
+		writeError(w, r, "revertPhoneById", "getting revision from request", badRequest(err))
+		return
+	}
+
+	ifMatch, err := c.getIfMatchFromReq(r)
+	if err != nil {
+		writeError(w, r, "revertPhoneById", "checking preconditions", err)
+		return
+	}
+
+	phone, err := c.phonesService.RevertPhoneById(r.Context(), getActorFromReq(r), id, rev, ifMatch)
+	if err != nil {
+		writeError(w, r, "revertPhoneById", "service error", err)
+		return
+	}
+
+	response, err := json.Marshal(phone)
+	if err != nil {
+		writeError(w, r, "revertPhoneById", "marshal error", err)
+		return
+	}
+
+	w.Header().Set("Location", phoneLocation(phone))
+	w.Header().Set("ETag", phoneETag(phone))
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
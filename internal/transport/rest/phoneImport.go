@@ -0,0 +1,132 @@
+package rest
+
+import (
+	"crud-go/internal/entity"
+	"crud-go/internal/service"
+	"crud-go/pkg/logging"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// importFormats maps the media types of import bodies to their formats.
+var importFormats = map[string]entity.ImportFormat{
+	"text/csv":             entity.ImportCSV,
+	"application/x-ndjson": entity.ImportNDJSON,
+	"application/ndjson":   entity.ImportNDJSON,
+	"application/jsonl":    entity.ImportNDJSON,
+}
+
+func getImportFormatFromReq(r *http.Request) (entity.ImportFormat, error) {
+	if v := r.URL.Query().Get("format"); v != "" {
+		format, err := entity.ParseImportFormat(v)
+		if err != nil {
+			return "", badRequest(err)
+		}
+		return format, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	format, ok := importFormats[mediaType]
+	if !ok {
+		return "", unsupportedMediaType(fmt.Errorf("import text/csv or application/x-ndjson, or set format"))
+	}
+
+	return format, nil
+}
+
+// @Summary Import phones from CSV or NDJSON
+// @Description Upserts the phones of a CSV file, whose header names the field of every column (brand, model, year, os, processor), or of a file with a JSON phone per line. A row updates the live phone with the same natural key, brand and model ignoring case by default, or creates one. Invalid rows are skipped and listed in the report. The body is streamed, so files can be large
+// @Tags Phones
+// @Security BearerAuth
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Produce json
+// @Param format query string false "csv or ndjson, instead of the Content-Type"
+// @Param dry_run query bool false "Only report what the import would do"
+// @Param file body string true "The file"
+// @Success 200 {object} entity.PhoneImportReport "OK"
+// @Failure 400 {object} ImportProblem "Bad Request; when the file stops being readable, the report of the rows before"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 403 {object} Problem "Forbidden"
+// @Failure 415 {object} Problem "Unsupported Media Type"
+// @Failure 500 {object} Problem "Internal Server Error"
+// @Router /api/phones/import [post]
+func (c *Controller) importPhones(w http.ResponseWriter, r *http.Request) {
+	format, err := getImportFormatFromReq(r)
+	if err != nil {
+		writeError(w, r, "importPhones", "detecting format", err)
+		return
+	}
+
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			writeError(w, r, "importPhones", "parsing query", badRequest(fmt.Errorf("invalid dry_run %q", v)))
+			return
+		}
+	}
+
+	c.extendDeadlines(w, r)
+
+	rows, err := entity.NewPhoneRowReader(r.Body, format)
+	if err != nil {
+		writeError(w, r, "importPhones", "reading header", badRequest(err))
+		return
+	}
+
+	report, err := c.phonesService.ImportPhones(r.Context(), getActorFromReq(r), rows, dryRun)
+	if service.ErrorKindOf(err) == service.KindValidation {
+		writeImportProblem(w, r, err, report)
+		return
+	}
+	if err != nil {
+		writeError(w, r, "importPhones", "service error", err)
+		return
+	}
+
+	response, err := json.Marshal(report)
+	if err != nil {
+		writeError(w, r, "importPhones", "marshal error", err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// ImportProblem is the problem of an import that stopped because the file
+// couldn't be read to the end, with the report of the rows before.
+type ImportProblem struct {
+	Problem
+	Report entity.PhoneImportReport `json:"report"`
+}
+
+func writeImportProblem(w http.ResponseWriter, r *http.Request, err error, report entity.PhoneImportReport) {
+	p := ImportProblem{Problem: newProblem(r, err), Report: report}
+	logging.FromContext(r.Context()).WithFields(logrus.Fields{
+		"handler": "importPhones",
+		"problem": "reading the file",
+		"status":  p.Status,
+	}).Warn(err)
+
+	writeProblemBody(w, p.Status, p)
+}
+
+// extendDeadlines gives the import importTimeout to upload the body and
+// write the report; the server timeouts are sized for ordinary requests.
+func (c *Controller) extendDeadlines(w http.ResponseWriter, r *http.Request) {
+	deadline := time.Now().Add(c.importTimeout)
+	rc := http.NewResponseController(w)
+	err := errors.Join(rc.SetReadDeadline(deadline), rc.SetWriteDeadline(deadline))
+	if err != nil {
+		logging.FromContext(r.Context()).WithField("handler", "importPhones").
+			Warnf("keeping the server timeouts: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package rest
+
+import (
+	"crud-go/internal/entity"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+func getPhoneSearchQueryFromReq(r *http.Request) (entity.PhoneSearchQuery, error) {
+	values := r.URL.Query()
+	q := entity.PhoneSearchQuery{Text: values.Get("q")}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return q, fmt.Errorf("invalid limit %q", v)
+		}
+		q.Limit = limit
+	}
+
+	return q, nil
+}
+
+// @Summary Search phones
+// @Description Full-text search over brand, model, OS and processor; words match as prefixes. When nothing matches, phones with similar spellings are returned and fuzzy is true. Highlights are HTML-escaped with the matches wrapped in <mark>
+// @Tags Phones
+// @Security BearerAuth
+// @Produce json
+// @Param q query string true "Words to search for"
+// @Param limit query int false "Number of results (default 20, max 100)"
+// @Success 200 {object} entity.PhoneSearchResult "OK"
+// @Failure 400 {object} Problem "Bad Request"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 500 {object} Problem "Internal Server Error"
+// @Router /api/phones/search [get]
+func (c *Controller) searchPhones(w http.ResponseWriter, r *http.Request) {
+	query, err := getPhoneSearchQueryFromReq(r)
+	if err != nil {
+		writeError(w, r, "searchPhones", "parsing query", badRequest(err))
+		return
+	}
+
+	result, err := c.phonesService.SearchPhones(r.Context(), query)
+	if err != nil {
+		writeError(w, r, "searchPhones", "service error", err)
+		return
+	}
+
+	response, err := json.Marshal(result)
+	if err != nil {
+		writeError(w, r, "searchPhones", "marshal error", err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
@@ -0,0 +1,49 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// @Summary Suggest phone field values
+// @Description Typeahead for brand, model and processor: the distinct values of the live phones starting with prefix, ignoring case, the most common first
+// @Tags Phones
+// @Security BearerAuth
+// @Produce json
+// @Param field query string true "Field: brand, model or processor"
+// @Param prefix query string false "Start of the value"
+// @Param limit query int false "Number of suggestions (default 10, max 50)"
+// @Success 200 {array} entity.Suggestion "OK"
+// @Failure 400 {object} Problem "Bad Request"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 500 {object} Problem "Internal Server Error"
+// @Router /api/phones/suggest [get]
+func (c *Controller) suggestPhoneValues(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+
+	var limit int
+	if v := values.Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			writeError(w, r, "suggestPhoneValues", "parsing query", badRequest(fmt.Errorf("invalid limit %q", v)))
+			return
+		}
+	}
+
+	suggestions, err := c.phonesService.SuggestPhoneValues(r.Context(), values.Get("field"), values.Get("prefix"), limit)
+	if err != nil {
+		writeError(w, r, "suggestPhoneValues", "service error", err)
+		return
+	}
+
+	response, err := json.Marshal(suggestions)
+	if err != nil {
+		writeError(w, r, "suggestPhoneValues", "marshal error", err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
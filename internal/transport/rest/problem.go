@@ -0,0 +1,203 @@
+package rest
+
+import (
+	"crud-go/internal/entity"
+	"crud-go/internal/service"
+	"crud-go/pkg/logging"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+)
+
+const problemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 error response.
+type Problem struct {
+	Type      string              `json:"type"`
+	Title     string              `json:"title"`
+	Status    int                 `json:"status"`
+	Detail    string              `json:"detail,omitempty"`
+	Instance  string              `json:"instance,omitempty"`
+	RequestID string              `json:"request_id,omitempty"`
+	Errors    []entity.FieldError `json:"errors,omitempty"`
+}
+
+var problemStatuses = map[service.ErrorKind]int{
+	service.KindNotFound:             http.StatusNotFound,
+	service.KindConflict:             http.StatusConflict,
+	service.KindValidation:           http.StatusBadRequest,
+	service.KindUnauthorized:         http.StatusUnauthorized,
+	service.KindForbidden:            http.StatusForbidden,
+	service.KindPreconditionFailed:   http.StatusPreconditionFailed,
+	service.KindPreconditionRequired: http.StatusPreconditionRequired,
+}
+
+func problemType(kind string) string {
+	return "/problems/" + kind
+}
+
+// newProblem builds the response for err. Internal errors get a generic
+// detail so that nothing about the backend leaks to the client.
+func newProblem(r *http.Request, err error) Problem {
+	p := Problem{
+		Type:     problemType("internal"),
+		Status:   http.StatusInternalServerError,
+		Detail:   "the server failed to handle the request",
+		Instance: r.URL.Path,
+	}
+
+	var svcErr *service.Error
+	var validationErrs validator.ValidationErrors
+	var reqErr *requestError
+
+	switch {
+	case errors.As(err, &svcErr):
+		p.Type = problemType(string(svcErr.Kind))
+		p.Status = problemStatuses[svcErr.Kind]
+		p.Detail = svcErr.Detail
+		p.Errors = svcErr.Fields
+		if errors.As(err, &validationErrs) {
+			p.Errors = entity.FieldErrors(err, acceptedLanguages(r)...)
+		}
+	case errors.As(err, &validationErrs):
+		p.Type = problemType(string(service.KindValidation))
+		p.Status = http.StatusBadRequest
+		p.Detail = "validation failed"
+		p.Errors = entity.FieldErrors(err, acceptedLanguages(r)...)
+	case errors.As(err, &reqErr):
+		p.Type = problemType(reqErr.kind)
+		p.Status = reqErr.status
+		p.Detail = reqErr.Error()
+	}
+
+	if p.Status == 0 {
+		p.Status = http.StatusInternalServerError
+	}
+	p.Title = http.StatusText(p.Status)
+	p.RequestID, _ = r.Context().Value(ctxRequestID).(string)
+
+	return p
+}
+
+// acceptedLanguages returns the languages of the Accept-Language header
+// from the most to the least preferred, e.g. "ru-RU,ru;q=0.9,en;q=0.8"
+// gives ru_RU, ru and en.
+func acceptedLanguages(r *http.Request) []string {
+	type lang struct {
+		tag string
+		q   float64
+	}
+
+	var langs []lang
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+
+		langs = append(langs, lang{tag: strings.ReplaceAll(tag, "-", "_"), q: q})
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool {
+		return langs[i].q > langs[j].q
+	})
+
+	tags := make([]string, 0, len(langs)*2)
+	for _, l := range langs {
+		tags = append(tags, l.tag)
+		if base, _, ok := strings.Cut(l.tag, "_"); ok {
+			tags = append(tags, base)
+		}
+	}
+
+	return tags
+}
+
+// writeError logs err with the same fields handlers always used and answers
+// with the matching problem.
+func writeError(w http.ResponseWriter, r *http.Request, handler, problem string, err error) {
+	p := newProblem(r, err)
+
+	entry := logging.FromContext(r.Context()).WithFields(logrus.Fields{
+		"handler": handler,
+		"problem": problem,
+		"status":  p.Status,
+	})
+	if p.Status >= http.StatusInternalServerError {
+		entry.Error(err)
+	} else {
+		entry.Warn(err)
+	}
+
+	writeProblem(w, p)
+}
+
+func writeProblem(w http.ResponseWriter, p Problem) {
+	writeProblemBody(w, p.Status, p)
+}
+
+// writeProblemBody writes a problem extended with members of its own.
+func writeProblemBody(w http.ResponseWriter, status int, body any) {
+	response, err := json.Marshal(body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// requestError is a request the transport can't even hand to a service,
+// like an unparsable body or path, or a body of an unsupported media type.
+type requestError struct {
+	status int
+	kind   string
+	err    error
+}
+
+func badRequest(err error) error {
+	return &requestError{status: http.StatusBadRequest, kind: "bad-request", err: err}
+}
+
+func payloadTooLarge(err error) error {
+	return &requestError{status: http.StatusRequestEntityTooLarge, kind: "payload-too-large", err: err}
+}
+
+func unsupportedMediaType(err error) error {
+	return &requestError{status: http.StatusUnsupportedMediaType, kind: "unsupported-media-type", err: err}
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, newProblem(r, service.NotFound("no resource at %s", r.URL.Path)))
+}
+
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, newProblem(r, &requestError{
+		status: http.StatusMethodNotAllowed,
+		kind:   "method-not-allowed",
+		err:    errors.New(r.Method + " is not supported by " + r.URL.Path),
+	}))
+}
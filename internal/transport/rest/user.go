@@ -7,121 +7,217 @@ import (
 
 	_ "crud-go/docs"
 	"crud-go/internal/entity"
-
-	"github.com/sirupsen/logrus"
 )
 
-// @Summary SignIn
-// @Description SignIn
+// @Summary Sign in
+// @Description Exchange credentials for an access token
 // @Tags Users
 // @Accept json
 // @Produce json
-// @Param id path int true "Phone ID"
-// @Success 200 {object} entity.Phone "OK"
-// @Failure 400 {string} string "Bad Request"
-// @Router /api/phones/{id} [get]
+// @Param credentials body entity.SignInInput true "Credentials"
+// @Success 200 {object} entity.Tokens "OK"
+// @Failure 400 {object} Problem "Bad Request"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 500 {object} Problem "Internal Server Error"
+// @Router /api/users/sign-in [post]
 func (c *Controller) signIn(w http.ResponseWriter, r *http.Request) {
 	reqBytes, err := io.ReadAll(r.Body)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"handler": "signIn",
-			"problem": "reading body",
-		}).Error(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, "signIn", "reading body", badRequest(err))
 		return
 	}
 
 	var inp entity.SignInInput
 	if err = json.Unmarshal(reqBytes, &inp); err != nil {
-		logrus.WithFields(logrus.Fields{
-			"handler": "signIn",
-			"problem": "unmarshal error",
-		}).Error(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, "signIn", "unmarshal error", badRequest(err))
 		return
 	}
 
 	if err := inp.Validate(); err != nil {
-		logrus.WithFields(logrus.Fields{
-			"handler": "signUp",
-			"problem": "validation error",
-		}).Error(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, "signIn", "validation error", err)
 		return
 	}
 
-	token, err := c.usersService.SignIn(r.Context(), inp)
+	tokens, err := c.usersService.SignIn(r.Context(), inp)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"handler": "signIn",
-			"problem": "service error",
-		}).Error(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		signIns.WithLabelValues("failure").Inc()
+		writeError(w, r, "signIn", "service error", err)
 		return
 	}
+	signIns.WithLabelValues("success").Inc()
 
-	response, err := json.Marshal(map[string]string{
-		"token": token,
-	})
+	response, err := json.Marshal(tokens)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{	
-			"handler": "signIn",
-			"problem": "marshal error",
-		}).Error(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, "signIn", "marshal error", err)
+		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	w.Header().Add("Content-Type", "application/json")
 	w.Write(response)
 }
 
-// @Summary Sign up a new user]
+// @Summary Refresh tokens
+// @Description Exchange a refresh token for a new token pair. The presented refresh token can't be used again.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param token body entity.RefreshInput true "Refresh token"
+// @Success 200 {object} entity.Tokens "OK"
+// @Failure 400 {object} Problem "Bad Request"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 500 {object} Problem "Internal Server Error"
+// @Router /api/users/refresh [post]
+func (c *Controller) refresh(w http.ResponseWriter, r *http.Request) {
+	reqBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, "refresh", "reading body", badRequest(err))
+		return
+	}
+
+	var inp entity.RefreshInput
+	if err = json.Unmarshal(reqBytes, &inp); err != nil {
+		writeError(w, r, "refresh", "unmarshal error", badRequest(err))
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		writeError(w, r, "refresh", "validation error", err)
+		return
+	}
+
+	tokens, err := c.usersService.Refresh(r.Context(), inp.RefreshToken)
+	if err != nil {
+		writeError(w, r, "refresh", "service error", err)
+		return
+	}
+
+	response, err := json.Marshal(tokens)
+	if err != nil {
+		writeError(w, r, "refresh", "marshal error", err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// @Summary Log out
+// @Description Revoke the access token of the request and the refresh tokens of its session
+// @Tags Users
+// @Security BearerAuth
+// @Success 204 {string} string "No Content"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 500 {object} Problem "Internal Server Error"
+// @Router /api/users/logout [post]
+func (c *Controller) logout(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(ctxClaims).(entity.AccessClaims)
+
+	if err := c.usersService.Logout(r.Context(), claims); err != nil {
+		writeError(w, r, "logout", "service error", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Log out everywhere
+// @Description Revoke every access and refresh token of the current user
+// @Tags Users
+// @Security BearerAuth
+// @Success 204 {string} string "No Content"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 500 {object} Problem "Internal Server Error"
+// @Router /api/users/logout-all [post]
+func (c *Controller) logoutAll(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ctxUserID).(int64)
+
+	if err := c.usersService.LogoutAll(r.Context(), userID); err != nil {
+		writeError(w, r, "logoutAll", "service error", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Change the role of a user
+// @Description Set the role of a user. Requires the admin role.
+// @Tags Users
+// @Security BearerAuth
+// @Accept json
+// @Param id path int true "User ID"
+// @Param role body entity.RoleInput true "Role"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} Problem "Bad Request"
+// @Failure 401 {object} Problem "Unauthorized"
+// @Failure 403 {object} Problem "Forbidden"
+// @Failure 404 {object} Problem "Not Found"
+// @Failure 500 {object} Problem "Internal Server Error"
+// @Router /api/users/{id}/role [put]
+func (c *Controller) setRole(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromReq(r)
+	if err != nil {
+		writeError(w, r, "setRole", "getting id from request", badRequest(err))
+		return
+	}
+
+	reqBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, "setRole", "reading body", badRequest(err))
+		return
+	}
+
+	var inp entity.RoleInput
+	if err = json.Unmarshal(reqBytes, &inp); err != nil {
+		writeError(w, r, "setRole", "unmarshal error", badRequest(err))
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		writeError(w, r, "setRole", "validation error", err)
+		return
+	}
+
+	err = c.usersService.SetRole(r.Context(), id, inp.Role)
+	if err != nil {
+		writeError(w, r, "setRole", "service error", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Sign up a new user
 // @Description Create a new user record
 // @Tags Users
 // @Accept json
 // @Produce json
 // @Param user body entity.SignUpInput true "User Data"
 // @Success 201 {string} string "Created"
-// @Failure 400 {string} string "Bad Request"
-// @Failure 500 {string} string "Internal Server Error"
-// @Router /api/users [post]
+// @Failure 400 {object} Problem "Bad Request"
+// @Failure 409 {object} Problem "Conflict"
+// @Failure 500 {object} Problem "Internal Server Error"
+// @Router /api/users/sign-up [post]
 func (c *Controller) signUp(w http.ResponseWriter, r *http.Request) {
 	reqBytes, err := io.ReadAll(r.Body)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"handler": "signUp",
-			"problem": "reading body",
-		}).Error(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, "signUp", "reading body", badRequest(err))
 		return
 	}
 
 	var inp entity.SignUpInput
 	if err = json.Unmarshal(reqBytes, &inp); err != nil {
-		logrus.WithFields(logrus.Fields{
-			"handler": "signUp",
-			"problem": "unmarshal error",
-		}).Error(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, "signUp", "unmarshal error", badRequest(err))
 		return
 	}
 
 	if err := inp.Validate(); err != nil {
-		logrus.WithFields(logrus.Fields{
-			"handler": "signUp",
-			"problem": "validation error",
-		}).Error(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, "signUp", "validation error", err)
 		return
 	}
 
 	err = c.usersService.SignUp(r.Context(), inp)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"handler": "signUp",
-			"problem": "service error",
-		}).Error(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, "signUp", "service error", err)
 		return
 	}
 
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS phones
+(
+    id        BIGSERIAL PRIMARY KEY,
+    brand     VARCHAR(255) NOT NULL,
+    model     VARCHAR(255) NOT NULL,
+    year      INTEGER      NOT NULL,
+    os        VARCHAR(255) NOT NULL,
+    processor VARCHAR(255) NOT NULL
+);
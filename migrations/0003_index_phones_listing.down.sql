@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS phones_lower_os_idx;
+DROP INDEX IF EXISTS phones_lower_brand_idx;
+DROP INDEX IF EXISTS phones_processor_id_idx;
+DROP INDEX IF EXISTS phones_os_id_idx;
+DROP INDEX IF EXISTS phones_year_id_idx;
+DROP INDEX IF EXISTS phones_model_id_idx;
+DROP INDEX IF EXISTS phones_brand_id_idx;
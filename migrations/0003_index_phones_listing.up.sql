@@ -0,0 +1,7 @@
+CREATE INDEX IF NOT EXISTS phones_brand_id_idx ON phones (brand, id);
+CREATE INDEX IF NOT EXISTS phones_model_id_idx ON phones (model, id);
+CREATE INDEX IF NOT EXISTS phones_year_id_idx ON phones (year, id);
+CREATE INDEX IF NOT EXISTS phones_os_id_idx ON phones (os, id);
+CREATE INDEX IF NOT EXISTS phones_processor_id_idx ON phones (processor, id);
+CREATE INDEX IF NOT EXISTS phones_lower_brand_idx ON phones (lower(brand));
+CREATE INDEX IF NOT EXISTS phones_lower_os_idx ON phones (lower(os));
@@ -0,0 +1,5 @@
+-- Everybody starts as a viewer. The first administrator has to be promoted
+-- by hand: UPDATE users SET role = 'admin' WHERE email = '...';
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'viewer'
+        CONSTRAINT users_role_check CHECK (role IN ('viewer', 'editor', 'admin'));
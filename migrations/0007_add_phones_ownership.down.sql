@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS phones_created_by_id_idx;
+
+ALTER TABLE phones
+    DROP COLUMN IF EXISTS updated_at,
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS updated_by,
+    DROP COLUMN IF EXISTS created_by;
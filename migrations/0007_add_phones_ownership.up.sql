@@ -0,0 +1,7 @@
+ALTER TABLE phones
+    ADD COLUMN IF NOT EXISTS created_by BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS updated_by BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS phones_created_by_id_idx ON phones (created_by, id);
@@ -0,0 +1,2 @@
+ALTER TABLE phones
+    DROP COLUMN IF EXISTS version;
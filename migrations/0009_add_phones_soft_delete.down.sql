@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS phones_deleted_at_idx;
+
+DELETE FROM phones WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE phones
+    DROP COLUMN IF EXISTS deleted_by,
+    DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,5 @@
+ALTER TABLE phones
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS deleted_by BIGINT REFERENCES users (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS phones_deleted_at_idx ON phones (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,14 @@
+-- Revisions outlive the phone they describe, so there is no foreign key to
+-- phones: purging the trash keeps the history.
+CREATE TABLE IF NOT EXISTS phone_revisions
+(
+    phone_id   BIGINT      NOT NULL,
+    revision   BIGINT      NOT NULL,
+    action     VARCHAR(16) NOT NULL CHECK (action IN ('create', 'update', 'delete', 'restore')),
+    actor_id   BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    before     JSONB,
+    after      JSONB,
+    changes    JSONB       NOT NULL,
+    PRIMARY KEY (phone_id, revision)
+);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS phones_search_text_trgm_idx;
+DROP INDEX IF EXISTS phones_search_vector_idx;
+
+ALTER TABLE phones
+    DROP COLUMN IF EXISTS search_text,
+    DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,17 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- search_vector serves full-text search, search_text the trigram fallback
+-- for queries with typos.
+ALTER TABLE phones
+    ADD COLUMN IF NOT EXISTS search_vector TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', brand), 'A') ||
+        setweight(to_tsvector('simple', model), 'A') ||
+        setweight(to_tsvector('simple', os), 'B') ||
+        setweight(to_tsvector('simple', processor), 'C')
+    ) STORED,
+    ADD COLUMN IF NOT EXISTS search_text TEXT GENERATED ALWAYS AS (
+        lower(brand || ' ' || model || ' ' || os || ' ' || processor)
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS phones_search_vector_idx ON phones USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS phones_search_text_trgm_idx ON phones USING GIN (search_text gin_trgm_ops);
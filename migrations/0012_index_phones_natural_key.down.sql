@@ -0,0 +1 @@
+DROP INDEX IF EXISTS phones_lower_brand_model_idx;
@@ -0,0 +1,2 @@
+-- Imports find the phones to update by brand and model, ignoring case.
+CREATE INDEX IF NOT EXISTS phones_lower_brand_model_idx ON phones (lower(brand), lower(model)) WHERE deleted_at IS NULL;
@@ -0,0 +1,11 @@
+// Package migrations holds the versioned SQL schema of the service.
+//
+// Every change to the schema is a pair of files named
+// <version>_<name>.up.sql and <version>_<name>.down.sql. Versions are
+// applied in ascending order and must never be edited once released.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,159 @@
+package hash
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2idParams keep the tests fast; the format is what matters.
+var testArgon2idParams = Argon2idParams{Memory: 64, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+func mustHash(t *testing.T, alg Algorithm, password string) string {
+	t.Helper()
+
+	encoded, err := alg.Hash(password)
+	if err != nil {
+		t.Fatalf("hashing: %v", err)
+	}
+
+	return encoded
+}
+
+func TestDecodeArgon2id(t *testing.T) {
+	valid := mustHash(t, NewArgon2idHasher(testArgon2idParams), "secret")
+	salt, key := strings.Split(valid, "$")[4], strings.Split(valid, "$")[5]
+
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr bool
+	}{
+		{"valid", valid, false},
+		{"zero memory", "$argon2id$v=19$m=0,t=1,p=1$" + salt + "$" + key, true},
+		{"zero time", "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key, true},
+		{"zero threads", "$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key, true},
+		{"other version", "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key, true},
+		{"argon2i", "$argon2i$v=19$m=64,t=1,p=1$" + salt + "$" + key, true},
+		{"bad parameters", "$argon2id$v=19$m=x,t=1,p=1$" + salt + "$" + key, true},
+		{"bad salt", "$argon2id$v=19$m=64,t=1,p=1$!!$" + key, true},
+		{"empty key", "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$", true},
+		{"missing part", "$argon2id$v=19$m=64,t=1,p=1$" + salt, true},
+		{"empty", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := decodeArgon2id(tt.encoded)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeArgon2id() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSHA1HasherRecognizes(t *testing.T) {
+	legacy := NewSHA1Hasher("salt")
+	hashed := mustHash(t, legacy, "secret")
+
+	tests := []struct {
+		name    string
+		encoded string
+		want    bool
+	}{
+		{"own hash", hashed, true},
+		{"other salt", mustHash(t, NewSHA1Hasher("pepper"), "secret"), false},
+		{"truncated", hashed[:len(hashed)-1], false},
+		{"too long", hashed + "0", false},
+		{"argon2id", mustHash(t, NewArgon2idHasher(testArgon2idParams), "secret"), false},
+		{"bcrypt", mustHash(t, NewBcryptHasher(bcrypt.MinCost), "secret"), false},
+		{"empty", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := legacy.Recognizes(tt.encoded); got != tt.want {
+				t.Errorf("Recognizes(%q) = %v, want %v", tt.encoded, got, tt.want)
+			}
+		})
+	}
+}
+
+func newTestPasswordHasher() (*PasswordHasher, *Argon2idHasher, *BcryptHasher, *SHA1Hasher) {
+	argon2id := NewArgon2idHasher(testArgon2idParams)
+	bcryptHasher := NewBcryptHasher(bcrypt.MinCost)
+	legacy := NewSHA1Hasher("salt")
+
+	return NewPasswordHasher(argon2id, bcryptHasher, legacy), argon2id, bcryptHasher, legacy
+}
+
+func TestPasswordHasherVerify(t *testing.T) {
+	hasher, argon2id, bcryptHasher, legacy := newTestPasswordHasher()
+	argonHash := mustHash(t, argon2id, "secret")
+	salt, key := strings.Split(argonHash, "$")[4], strings.Split(argonHash, "$")[5]
+
+	tests := []struct {
+		name     string
+		password string
+		encoded  string
+		want     bool
+		wantErr  error
+	}{
+		{"argon2id", "secret", argonHash, true, nil},
+		{"argon2id wrong password", "wrong", argonHash, false, nil},
+		{"bcrypt", "secret", mustHash(t, bcryptHasher, "secret"), true, nil},
+		{"bcrypt wrong password", "wrong", mustHash(t, bcryptHasher, "secret"), false, nil},
+		{"legacy", "secret", mustHash(t, legacy, "secret"), true, nil},
+		{"legacy wrong password", "wrong", mustHash(t, legacy, "secret"), false, nil},
+		{"argon2id zero threads", "secret", "$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key, false, errMalformedArgon2id},
+		{"argon2id zero time", "secret", "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key, false, errMalformedArgon2id},
+		{"unknown", "secret", "plain text", false, ErrUnknownHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := hasher.Verify(tt.password, tt.encoded)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordHasherNeedsRehash(t *testing.T) {
+	hasher, argon2id, bcryptHasher, legacy := newTestPasswordHasher()
+	stronger := testArgon2idParams
+	stronger.Time = 2
+
+	tests := []struct {
+		name    string
+		encoded string
+		want    bool
+	}{
+		{"current argon2id", mustHash(t, argon2id, "secret"), false},
+		{"argon2id with other parameters", mustHash(t, NewArgon2idHasher(stronger), "secret"), true},
+		{"malformed argon2id", "$argon2id$v=19$m=64,t=1,p=0$c2FsdA$a2V5", true},
+		{"bcrypt", mustHash(t, bcryptHasher, "secret"), true},
+		{"legacy", mustHash(t, legacy, "secret"), true},
+		{"unknown", "plain text", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasher.NeedsRehash(tt.encoded); got != tt.want {
+				t.Errorf("NeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
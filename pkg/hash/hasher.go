@@ -0,0 +1,61 @@
+package hash
+
+import "errors"
+
+var ErrUnknownHash = errors.New("password hash format is not recognized")
+
+type Algorithm interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	Recognizes(encoded string) bool
+	NeedsRehash(encoded string) bool
+}
+
+// PasswordHasher hashes new passwords with the primary algorithm and still
+// verifies hashes made by the others, so stored hashes can be migrated one
+// successful sign in at a time.
+type PasswordHasher struct {
+	primary Algorithm
+	others  []Algorithm
+}
+
+func NewPasswordHasher(primary Algorithm, others ...Algorithm) *PasswordHasher {
+	return &PasswordHasher{primary: primary, others: others}
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	return h.primary.Hash(password)
+}
+
+func (h *PasswordHasher) Verify(password, encoded string) (bool, error) {
+	alg := h.algorithm(encoded)
+	if alg == nil {
+		return false, ErrUnknownHash
+	}
+
+	return alg.Verify(password, encoded)
+}
+
+// NeedsRehash reports whether the hash should be replaced by a fresh one
+// from the primary algorithm.
+func (h *PasswordHasher) NeedsRehash(encoded string) bool {
+	if !h.primary.Recognizes(encoded) {
+		return true
+	}
+
+	return h.primary.NeedsRehash(encoded)
+}
+
+func (h *PasswordHasher) algorithm(encoded string) Algorithm {
+	if h.primary.Recognizes(encoded) {
+		return h.primary
+	}
+
+	for _, alg := range h.others {
+		if alg.Recognizes(encoded) {
+			return alg
+		}
+	}
+
+	return nil
+}
@@ -2,9 +2,15 @@ package hash
 
 import (
 	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/hex"
 	"fmt"
+	"strings"
 )
 
+// SHA1Hasher is the legacy hasher: one unsalted SHA-1 round with the hex of
+// the "salt" prepended to the digest. It is only kept to verify old hashes
+// until their owners sign in and get rehashed.
 type SHA1Hasher struct {
 	salt string
 }
@@ -22,3 +28,21 @@ func (h *SHA1Hasher) Hash(password string) (string, error) {
 
 	return fmt.Sprintf("%x", hash.Sum([]byte(h.salt))), nil
 }
+
+func (h *SHA1Hasher) Verify(password, encoded string) (bool, error) {
+	hash, err := h.Hash(password)
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(encoded)) == 1, nil
+}
+
+func (h *SHA1Hasher) Recognizes(encoded string) bool {
+	prefix := hex.EncodeToString([]byte(h.salt))
+	return len(encoded) == len(prefix)+2*sha1.Size && strings.HasPrefix(encoded, prefix)
+}
+
+func (h *SHA1Hasher) NeedsRehash(encoded string) bool {
+	return true
+}
@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+type ctxKey struct{}
+
+// holder lets middlewares further down the chain add fields that the
+// middlewares which created the logger still see, e.g. the user id set by
+// authentication shows up in the access log.
+type holder struct {
+	mu    sync.RWMutex
+	entry *logrus.Entry
+}
+
+// WithContext stores entry as the logger of ctx.
+func WithContext(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, ctxKey{}, &holder{entry: entry})
+}
+
+// FromContext returns the logger of ctx, or the standard logger when ctx
+// has none.
+func FromContext(ctx context.Context) *logrus.Entry {
+	h, ok := ctx.Value(ctxKey{}).(*holder)
+	if !ok {
+		return logrus.NewEntry(logrus.StandardLogger())
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.entry
+}
+
+// AddFields enriches the logger of ctx in place.
+func AddFields(ctx context.Context, fields logrus.Fields) {
+	h, ok := ctx.Value(ctxKey{}).(*holder)
+	if !ok {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.entry = h.entry.WithFields(fields)
+}
@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const redacted = "REDACTED"
+
+var sensitiveFields = map[string]bool{
+	"password":      true,
+	"new_password":  true,
+	"authorization": true,
+	"token":         true,
+	"refresh_token": true,
+	"hmac_secret":   true,
+	"cookie":        true,
+	"set-cookie":    true,
+}
+
+func isSensitive(name string) bool {
+	return sensitiveFields[strings.ToLower(name)]
+}
+
+// RedactHeaders returns a copy of h with credentials masked.
+func RedactHeaders(h http.Header) http.Header {
+	out := h.Clone()
+	for name := range out {
+		if isSensitive(name) {
+			out[name] = []string{redacted}
+		}
+	}
+
+	return out
+}
+
+// RedactHook masks the fields of every entry that may hold credentials, so
+// a password or a token can't end up in the logs by accident.
+type RedactHook struct{}
+
+func (RedactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (RedactHook) Fire(entry *logrus.Entry) error {
+	for name, value := range entry.Data {
+		switch v := value.(type) {
+		case http.Header:
+			entry.Data[name] = RedactHeaders(v)
+		default:
+			if isSensitive(name) {
+				entry.Data[name] = redacted
+			}
+		}
+	}
+
+	return nil
+}